@@ -5,14 +5,19 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"os"
+	"time"
 
 	ocli "github.com/oomol-lab/ovm-win/pkg/cli"
 	"github.com/oomol-lab/ovm-win/pkg/ipc/event"
 	"github.com/oomol-lab/ovm-win/pkg/logger"
+	"github.com/oomol-lab/ovm-win/pkg/podman"
 	"github.com/oomol-lab/ovm-win/pkg/types"
+	"github.com/oomol-lab/ovm-win/pkg/update"
 	"github.com/oomol-lab/ovm-win/pkg/util"
 	"github.com/urfave/cli/v3"
 )
@@ -26,19 +31,74 @@ var (
 	eventNpipeName string
 	bindPID        int64
 
+	ovmdMaxRestarts    int64
+	podmanPort         int64
+	podmanPortFallback bool
+	podmanNpipe        bool
+	podmanTCP          bool
+
+	podmanReadyTimeout  time.Duration
+	podmanReadyInterval time.Duration
+
+	dataMigrationDryRun bool
+	allowDataRecreate   bool
+	allowDowngrade      bool
+
+	rootfsSHA256   string
+	rootfsManifest string
+
 	oldImageDir string
 	newImageDir string
+
+	doctorFormat      string
+	doctorProbeDistro bool
+
+	diagnoseOutput string
+
+	logLevel    string
+	logFormat   string
+	logMaxSize  int64
+	logMaxAge   time.Duration
+	logKeep     int64
+	logCompress bool
 )
 
 var (
-	initCtx    *ocli.InitContext
-	runCtx     *ocli.RunContext
-	migrateCtx *ocli.MigrateContext
+	initCtx     *ocli.InitContext
+	runCtx      *ocli.RunContext
+	migrateCtx  *ocli.MigrateContext
+	doctorCtx   *ocli.DoctorContext
+	diagnoseCtx *ocli.DiagnoseContext
 )
 
 func cmd() error {
 	command := &cli.Command{
 		HideHelpCommand: true,
+		Before: func(ctx context.Context, command *cli.Command) error {
+			l, err := logger.ParseLevel(logLevel)
+			if err != nil {
+				return err
+			}
+			logger.SetLevel(l)
+
+			f, err := logger.ParseFormat(logFormat)
+			if err != nil {
+				return err
+			}
+			logger.SetFormat(f)
+
+			if logMaxSize < 0 || logMaxAge < 0 || logKeep < 1 {
+				return errors.New("--log-max-size and --log-max-age must not be negative, --log-keep must be at least 1")
+			}
+			logger.SetRotation(logger.Rotation{
+				MaxSize:  logMaxSize << 20,
+				MaxAge:   logMaxAge,
+				Keep:     int(logKeep),
+				Compress: logCompress,
+			})
+
+			return nil
+		},
 		Commands: []*cli.Command{
 			{
 				Name:  "init",
@@ -50,9 +110,6 @@ func cmd() error {
 
 					initCtx = ocli.InitCmd(&types.InitOpt{
 						IsElevatedProcess: false,
-						CanEnableFeature:  false,
-						CanReboot:         false,
-						CanUpdateWSL:      false,
 						BasicOpt: types.BasicOpt{
 							Name:           name,
 							LogPath:        logPath,
@@ -75,11 +132,43 @@ func cmd() error {
 						return errors.New("--event-npipe-name not specified")
 					}
 
+					if ovmdMaxRestarts < 0 {
+						return errors.New("--ovmd-max-restarts must not be negative")
+					}
+
+					if podmanPort < 0 || podmanPort > 65535 {
+						return fmt.Errorf("--podman-port must be between 1 and 65535 (or 0 for the default port), got %d", podmanPort)
+					}
+
+					if podmanReadyTimeout <= 0 || podmanReadyInterval <= 0 {
+						return errors.New("--podman-ready-timeout and --podman-ready-interval must be positive")
+					}
+
+					if b, err := hex.DecodeString(rootfsSHA256); err != nil || (rootfsSHA256 != "" && len(b) != sha256.Size) {
+						return fmt.Errorf("--rootfs-sha256 must be a SHA-256 in hex, got %q", rootfsSHA256)
+					}
+
+					if !podmanTCP && !podmanNpipe {
+						return errors.New("--podman-tcp=false requires --podman-npipe")
+					}
+
 					runCtx = ocli.RunCmd(&types.RunOpt{
-						DistroName: name,
-						ImageDir:   imageDir,
-						RootFSPath: rootFSPath,
-						Version:    versions,
+						DistroName:          name,
+						ImageDir:            imageDir,
+						RootFSPath:          rootFSPath,
+						Version:             versions,
+						OVMDMaxRestarts:     int(ovmdMaxRestarts),
+						PreferredPodmanPort: int(podmanPort),
+						PodmanPortFallback:  podmanPortFallback,
+						PodmanNpipe:         podmanNpipe,
+						PodmanTCP:           podmanTCP,
+						PodmanReadyTimeout:  podmanReadyTimeout,
+						PodmanReadyInterval: podmanReadyInterval,
+						DataMigrationDryRun: dataMigrationDryRun,
+						AllowDataRecreate:   allowDataRecreate,
+						AllowDowngrade:      allowDowngrade,
+						RootFSSHA256:        rootfsSHA256,
+						RootFSManifest:      rootfsManifest,
 						BasicOpt: types.BasicOpt{
 							Name:           name,
 							LogPath:        logPath,
@@ -105,12 +194,94 @@ func cmd() error {
 						Required:    true,
 						Destination: &rootFSPath,
 					},
+					&cli.StringFlag{
+						Name:        "rootfs-sha256",
+						Usage:       "Expected SHA-256 of the rootfs image, checked before the rootfs is updated",
+						Required:    false,
+						Destination: &rootfsSHA256,
+					},
+					&cli.StringFlag{
+						Name:        "rootfs-manifest",
+						Usage:       "Checksum file in the format of sha256sum which contains the rootfs image",
+						Required:    false,
+						Destination: &rootfsManifest,
+					},
 					&cli.StringFlag{
 						Name:        "versions",
 						Usage:       "Set versions",
 						Required:    true,
 						Destination: &versions,
 					},
+					&cli.IntFlag{
+						Name:        "ovmd-max-restarts",
+						Usage:       "Restart ovmd at most N times in a row when it exits unexpectedly, 0 means never restart",
+						Value:       5,
+						Required:    false,
+						Destination: &ovmdMaxRestarts,
+					},
+					&cli.IntFlag{
+						Name:        "podman-port",
+						Usage:       "Preferred podman port, default is the port of the last run",
+						Value:       0,
+						Required:    false,
+						Destination: &podmanPort,
+					},
+					&cli.BoolFlag{
+						Name:        "podman-port-fallback",
+						Usage:       "Use another free port when the preferred podman port is taken",
+						Value:       true,
+						Required:    false,
+						Destination: &podmanPortFallback,
+					},
+					&cli.BoolFlag{
+						Name:        "podman-npipe",
+						Usage:       "Proxy the podman API on the named pipe //./pipe/ovm-<name>-podman",
+						Value:       false,
+						Required:    false,
+						Destination: &podmanNpipe,
+					},
+					&cli.BoolFlag{
+						Name:        "podman-tcp",
+						Usage:       "Serve the podman API on 127.0.0.1:<podman-port>, set to false to only serve it on the named pipe (requires --podman-npipe)",
+						Value:       true,
+						Required:    false,
+						Destination: &podmanTCP,
+					},
+					&cli.DurationFlag{
+						Name:        "podman-ready-timeout",
+						Usage:       "How long to wait for podman to be ready",
+						Value:       podman.DefaultReadyTimeout,
+						Required:    false,
+						Destination: &podmanReadyTimeout,
+					},
+					&cli.DurationFlag{
+						Name:        "podman-ready-interval",
+						Usage:       "Interval between podman readiness probes",
+						Value:       podman.DefaultReadyInterval,
+						Required:    false,
+						Destination: &podmanReadyInterval,
+					},
+					&cli.BoolFlag{
+						Name:        "data-migration-dry-run",
+						Usage:       "Try the data migration on a copy of the data and exit without any change",
+						Value:       false,
+						Required:    false,
+						Destination: &dataMigrationDryRun,
+					},
+					&cli.BoolFlag{
+						Name:        "allow-data-recreate",
+						Usage:       "Recreate the data if it cannot be migrated to the new data version",
+						Value:       false,
+						Required:    false,
+						Destination: &allowDataRecreate,
+					},
+					&cli.BoolFlag{
+						Name:        "allow-downgrade",
+						Usage:       "Allow the rootfs and data versions older than the ones in the image directory",
+						Value:       false,
+						Required:    false,
+						Destination: &allowDowngrade,
+					},
 				},
 			},
 			{
@@ -151,6 +322,76 @@ func cmd() error {
 					},
 				},
 			},
+			{
+				Name:  "doctor",
+				Usage: "Run all the system requirement checks and print a report",
+				Before: func(ctx context.Context, command *cli.Command) error {
+					doctorCtx = ocli.DoctorCmd(&types.DoctorOpt{
+						Format:      doctorFormat,
+						ProbeDistro: doctorProbeDistro,
+						BasicOpt: types.BasicOpt{
+							Name:           name,
+							LogPath:        logPath,
+							EventNpipeName: "",
+							BindPID:        0,
+						},
+					})
+					return doctorCtx.Setup()
+				},
+				Action: func(ctx context.Context, command *cli.Command) error {
+					return doctorCtx.Start()
+				},
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:        "format",
+						Usage:       "Output format, json or table",
+						Value:       ocli.DoctorFormatTable,
+						Required:    false,
+						Destination: &doctorFormat,
+					},
+					&cli.BoolFlag{
+						Name:        "probe-distro",
+						Usage:       "Invoke a registered distro to check virtualization, it boots the WSL2 VM",
+						Value:       false,
+						Required:    false,
+						Destination: &doctorProbeDistro,
+					},
+				},
+			},
+			{
+				Name:  "diagnose",
+				Usage: "Collect the logs, configurations and the doctor report into a zip file",
+				Before: func(ctx context.Context, command *cli.Command) error {
+					diagnoseCtx = ocli.DiagnoseCmd(&types.DiagnoseOpt{
+						ImageDir: imageDir,
+						Output:   diagnoseOutput,
+						BasicOpt: types.BasicOpt{
+							Name:           name,
+							LogPath:        logPath,
+							EventNpipeName: "",
+							BindPID:        0,
+						},
+					})
+					return diagnoseCtx.Setup()
+				},
+				Action: func(ctx context.Context, command *cli.Command) error {
+					return diagnoseCtx.Start()
+				},
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:        "image-dir",
+						Usage:       "Image directory of the virtual machine, optional",
+						Required:    false,
+						Destination: &imageDir,
+					},
+					&cli.StringFlag{
+						Name:        "output",
+						Usage:       "Path of the zip file, default is a file in the log path",
+						Required:    false,
+						Destination: &diagnoseOutput,
+					},
+				},
+			},
 		},
 		Flags: []cli.Flag{
 			&cli.StringFlag{
@@ -182,6 +423,54 @@ func cmd() error {
 				Persistent:  true,
 				Destination: &bindPID,
 			},
+			&cli.StringFlag{
+				Name:        "log-level",
+				Usage:       "Minimum log level, one of trace, debug, info, warn, error",
+				Value:       "info",
+				Required:    false,
+				Persistent:  true,
+				Destination: &logLevel,
+			},
+			&cli.StringFlag{
+				Name:        "log-format",
+				Usage:       "Log line format, text or json",
+				Value:       "text",
+				Required:    false,
+				Persistent:  true,
+				Destination: &logFormat,
+			},
+			&cli.IntFlag{
+				Name:        "log-max-size",
+				Usage:       "Rotate the log file when it exceeds N megabytes, 0 disables",
+				Value:       50,
+				Required:    false,
+				Persistent:  true,
+				Destination: &logMaxSize,
+			},
+			&cli.DurationFlag{
+				Name:        "log-max-age",
+				Usage:       "Rotate the log file when it has been written for this long, 0 disables",
+				Value:       0,
+				Required:    false,
+				Persistent:  true,
+				Destination: &logMaxAge,
+			},
+			&cli.IntFlag{
+				Name:        "log-keep",
+				Usage:       "Number of log files kept for each log, including the current one",
+				Value:       5,
+				Required:    false,
+				Persistent:  true,
+				Destination: &logKeep,
+			},
+			&cli.BoolFlag{
+				Name:        "log-compress",
+				Usage:       "Compress the rotated log files with gzip",
+				Value:       false,
+				Required:    false,
+				Persistent:  true,
+				Destination: &logCompress,
+			},
 		},
 	}
 	return command.Run(context.Background(), os.Args)
@@ -203,6 +492,12 @@ func main() {
 		event.NotifyInit(event.InitExit)
 
 	case runCtx != nil:
+		if errors.Is(err, update.ErrDryRun) {
+			runCtx.Logger.Info(err.Error())
+			event.NotifyRun(event.DataMigrationDryRunFinished)
+			err = nil
+		}
+
 		if err != nil {
 			event.NotifyRun(event.RunError, err.Error())
 		}
@@ -211,6 +506,16 @@ func main() {
 		event.NotifyRun(event.RunExit)
 	case migrateCtx != nil:
 		log = migrateCtx.Logger
+	case doctorCtx != nil:
+		log = doctorCtx.Logger
+
+		// The failures are already in the report, keep the output parsable
+		if errors.Is(err, ocli.ErrDoctorFailed) {
+			log.Warn(err.Error())
+			util.Exit(1)
+		}
+	case diagnoseCtx != nil:
+		log = diagnoseCtx.Logger
 	}
 
 	if err != nil {
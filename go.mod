@@ -1,11 +1,12 @@
 module github.com/oomol-lab/ovm-win
 
-go 1.21.3
+go 1.22.0
 
 require (
 	github.com/Code-Hex/go-infinity-channel v1.0.0
 	github.com/Microsoft/go-winio v0.6.2
 	github.com/hashicorp/go-version v1.7.0
+	github.com/klauspost/compress v1.18.0
 	github.com/shirou/gopsutil/v4 v4.24.6
 	github.com/urfave/cli/v3 v3.0.0-alpha9
 	golang.org/x/sync v0.7.0
@@ -0,0 +1,80 @@
+// SPDX-FileCopyrightText: 2025 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/oomol-lab/ovm-win/pkg/diagnose"
+	"github.com/oomol-lab/ovm-win/pkg/logger"
+	"github.com/oomol-lab/ovm-win/pkg/types"
+)
+
+type DiagnoseContext struct {
+	types.DiagnoseOpt
+}
+
+func DiagnoseCmd(p *types.DiagnoseOpt) *DiagnoseContext {
+	return &DiagnoseContext{
+		*p,
+	}
+}
+
+func (c *DiagnoseContext) Setup() error {
+	if err := setupLogPath(&c.BasicOpt); err != nil {
+		return fmt.Errorf("failed to setup log path: %w", err)
+	}
+
+	if log, err := logger.New(c.LogPath, "diagnose-"+c.Name); err != nil {
+		return fmt.Errorf("failed to setup log: %w", err)
+	} else {
+		c.Logger = log
+	}
+
+	if c.ImageDir != "" {
+		p, err := filepath.Abs(c.ImageDir)
+		if err != nil {
+			return fmt.Errorf("failed to get imageDir absolute path from %s: %v", c.ImageDir, err)
+		}
+		c.ImageDir = p
+	}
+
+	if c.Output == "" {
+		c.Output = filepath.Join(c.LogPath, diagnoseFileName(c.Name))
+	}
+
+	return nil
+}
+
+func (c *DiagnoseContext) Start() error {
+	f, err := os.Create(c.Output)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", c.Output, err)
+	}
+
+	_, err = diagnose.Collect(c.Logger, &diagnose.Opt{
+		Name:     c.Name,
+		LogPath:  c.LogPath,
+		ImageDir: c.ImageDir,
+	}, f)
+	if closeErr := f.Close(); err == nil && closeErr != nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(c.Output)
+		return fmt.Errorf("failed to collect diagnostics: %w", err)
+	}
+
+	c.Logger.Infof("Diagnostics are saved to %s", c.Output)
+	fmt.Println(c.Output)
+	return nil
+}
+
+// diagnoseFileName returns the name of the diagnostic bundle, such as diagnose-foo-20250101-150405.zip
+func diagnoseFileName(name string) string {
+	return fmt.Sprintf("diagnose-%s-%s.zip", name, time.Now().Format("20060102-150405"))
+}
@@ -0,0 +1,120 @@
+// SPDX-FileCopyrightText: 2025 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/oomol-lab/ovm-win/pkg/logger"
+	"github.com/oomol-lab/ovm-win/pkg/types"
+	"github.com/oomol-lab/ovm-win/pkg/wsl"
+)
+
+const (
+	DoctorFormatJSON  = "json"
+	DoctorFormatTable = "table"
+)
+
+// ErrDoctorFailed is returned after the report is printed if any check failed
+var ErrDoctorFailed = errors.New("some doctor checks failed")
+
+type DoctorContext struct {
+	types.DoctorOpt
+}
+
+func DoctorCmd(p *types.DoctorOpt) *DoctorContext {
+	return &DoctorContext{
+		*p,
+	}
+}
+
+func (c *DoctorContext) Setup() error {
+	if c.Format != DoctorFormatJSON && c.Format != DoctorFormatTable {
+		return fmt.Errorf("unsupported format %q, only %s and %s are supported", c.Format, DoctorFormatJSON, DoctorFormatTable)
+	}
+
+	if err := setupLogPath(&c.BasicOpt); err != nil {
+		return fmt.Errorf("failed to setup log path: %w", err)
+	}
+
+	if log, err := logger.New(c.LogPath, "doctor-"+c.Name); err != nil {
+		return fmt.Errorf("failed to setup log: %w", err)
+	} else {
+		c.Logger = log
+	}
+
+	return nil
+}
+
+func (c *DoctorContext) Start() error {
+	report := wsl.Doctor(&c.DoctorOpt)
+
+	if c.Format == DoctorFormatJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return fmt.Errorf("failed to encode doctor report: %w", err)
+		}
+	} else {
+		writeDoctorTable(os.Stdout, report)
+	}
+
+	if !report.OK {
+		return ErrDoctorFailed
+	}
+
+	return nil
+}
+
+func writeDoctorTable(out io.Writer, report *wsl.Report) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "CHECK\tSTATUS\tMESSAGE")
+	for _, r := range report.Checks {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\n", r.Name, strings.ToUpper(string(r.Status)), r.Message)
+	}
+	_ = w.Flush()
+
+	for _, r := range report.Checks {
+		_, _ = fmt.Fprintf(out, "\n[%s]\n", r.Name)
+
+		writeEvidence(out, r.Evidence, "  ")
+
+		if r.Remediation != "" {
+			_, _ = fmt.Fprintf(out, "  => %s\n", r.Remediation)
+		}
+	}
+
+	if report.OK {
+		_, _ = fmt.Fprintln(out, "\nNo check failed")
+	} else {
+		_, _ = fmt.Fprintln(out, "\nSome checks failed, see the suggestions above")
+	}
+}
+
+func writeEvidence(out io.Writer, evidence map[string]any, indent string) {
+	keys := make([]string, 0, len(evidence))
+	for k := range evidence {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	for _, k := range keys {
+		switch v := evidence[k].(type) {
+		case map[string]any:
+			_, _ = fmt.Fprintf(out, "%s%s:\n", indent, k)
+			writeEvidence(out, v, indent+"  ")
+		case []string:
+			_, _ = fmt.Fprintf(out, "%s%s: %s\n", indent, k, strings.Join(v, " | "))
+		default:
+			_, _ = fmt.Fprintf(out, "%s%s: %v\n", indent, k, v)
+		}
+	}
+}
@@ -7,7 +7,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"path/filepath"
 
+	"github.com/oomol-lab/ovm-win/pkg/initstate"
 	"github.com/oomol-lab/ovm-win/pkg/ipc/event"
 	"github.com/oomol-lab/ovm-win/pkg/ipc/restful"
 	"github.com/oomol-lab/ovm-win/pkg/logger"
@@ -53,18 +55,36 @@ func (c *InitContext) Setup() error {
 
 	c.moveConsoleToParent()
 
-	event.Setup(c.Logger, `\\.\pipe\`+c.EventNpipeName)
+	// The elevated process only enables the feature, the state is maintained by the parent process
+	statePath := ""
+	if p, ok := util.ConfigPath(); ok && !c.IsElevatedProcess {
+		statePath = filepath.Join(p, c.Name+"_init-state.json")
+	}
+	c.State = initstate.New(c.Logger, statePath, sys.BootTime())
+
+	// The spool belongs to the parent process
+	spoolPath := ""
+	if !c.IsElevatedProcess {
+		spoolPath = filepath.Join(c.LogPath, "init-"+c.Name+"-events.spool")
+	}
+	event.Setup(c.Logger, `\\.\pipe\`+c.EventNpipeName, spoolPath)
 
 	return nil
 }
 
 func (c *InitContext) Start() error {
 	if c.IsElevatedProcess {
+		if err := c.State.To(initstate.EnablingFeature); err != nil {
+			return err
+		}
 		_ = wsl.Install(&c.InitOpt)
 		util.Exit(0)
 	}
 
 	if !sys.SupportWSL2(c.Logger) {
+		if err := c.State.To(initstate.SystemNotSupport); err != nil {
+			return err
+		}
 		event.NotifyInit(event.SystemNotSupport)
 		return fmt.Errorf("WSL2 is not supported on this system, need Windows 10 version 19043 or higher")
 	}
@@ -90,9 +110,7 @@ func (c *InitContext) Start() error {
 		return util.WaitBindPID(ctx, c.Logger, c.BindPID)
 	})
 
-	wsl.Check(ctx, &c.InitOpt)
-
-	return nil
+	return wsl.Check(ctx, &c.InitOpt)
 }
 
 func (c *InitContext) moveConsoleToParent() {
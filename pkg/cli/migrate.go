@@ -61,7 +61,7 @@ func (m *MigrateContext) Start() error {
 		break
 	default:
 		if err != nil {
-			log.Warnf("Failed to sync disk: %w", err)
+			log.Warnf("Failed to sync disk: %v", err)
 		}
 
 		if err := wsl.Terminate(log, m.DistroName); err != nil {
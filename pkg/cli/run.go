@@ -5,7 +5,9 @@ package cli
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
 	"strings"
@@ -13,6 +15,8 @@ import (
 	"github.com/oomol-lab/ovm-win/pkg/ipc/event"
 	"github.com/oomol-lab/ovm-win/pkg/ipc/restful"
 	"github.com/oomol-lab/ovm-win/pkg/logger"
+	"github.com/oomol-lab/ovm-win/pkg/podman"
+	"github.com/oomol-lab/ovm-win/pkg/portforward"
 	"github.com/oomol-lab/ovm-win/pkg/types"
 	"github.com/oomol-lab/ovm-win/pkg/update"
 	"github.com/oomol-lab/ovm-win/pkg/util"
@@ -31,6 +35,9 @@ func RunCmd(p *types.RunOpt) *RunContext {
 	}
 	r.RestfulEndpoint = `\\.\pipe\ovm-` + p.Name
 	r.DistroName = "ovm-" + r.Name
+	if r.PodmanNpipe {
+		r.PodmanNpipePath = `\\.\pipe\ovm-` + p.Name + `-podman`
+	}
 	return r
 }
 
@@ -44,24 +51,30 @@ func (c *RunContext) Setup() error {
 		if log, err := logger.New(c.LogPath, c.Name); err != nil {
 			return fmt.Errorf("failed to setup log: %w", err)
 		} else {
-			c.Logger = log
+			c.Logger = log.With("distro", c.DistroName)
 		}
 	}
 
-	event.Setup(c.Logger, `\\.\pipe\`+c.EventNpipeName)
+	event.Setup(c.Logger, `\\.\pipe\`+c.EventNpipeName, filepath.Join(c.LogPath, c.Name+"-events.spool"))
 
 	if err := c.update(); err != nil {
 		return fmt.Errorf("failed to update: %w", err)
 	}
 
-	if err := c.setupPort(); err != nil {
-		return fmt.Errorf("failed to get port: %w", err)
+	if c.PodmanTCP {
+		if err := c.setupPort(); err != nil {
+			return fmt.Errorf("failed to get port: %w", err)
+		}
+	} else {
+		c.Logger.Info("Podman TCP listener is disabled, podman is only served on the named pipe")
 	}
 
 	if err := c.setupSourceCodeDisk(); err != nil {
 		return fmt.Errorf("failed to setup source code disk: %w", err)
 	}
 
+	c.setupPortForward()
+
 	return nil
 }
 
@@ -76,6 +89,7 @@ func (c *RunContext) Start() error {
 	g.Go(func() error {
 		context.AfterFunc(ctx, func() {
 			_ = r.Close()
+			_ = c.Ports.Close()
 		})
 
 		return r.Run()
@@ -86,9 +100,22 @@ func (c *RunContext) Start() error {
 	})
 
 	g.Go(func() error {
-		return wsl.Launch(ctx, c.Logger, &c.RunOpt)
+		err := wsl.Launch(ctx, c.Logger, &c.RunOpt)
+		// the new version failed by itself before Ready, not because of stopping
+		if err != nil && ctx.Err() == nil && !c.StoppedWithAPI && update.Pending(c.ImageDir) {
+			if err := update.Rollback(&c.RunOpt); err != nil {
+				c.Logger.Warnf("Failed to roll back: %v", err)
+			}
+		}
+		return err
 	})
 
+	if c.PodmanNpipe {
+		g.Go(func() error {
+			return podman.ServeNpipe(ctx, c.Logger, c.PodmanNpipePath, wsl.PodmanDialer(&c.RunOpt))
+		})
+	}
+
 	err = g.Wait()
 	if c.StoppedWithAPI {
 		return nil
@@ -112,6 +139,14 @@ func (c *RunContext) update() error {
 	}
 	c.RootFSPath = p
 
+	if c.RootFSManifest != "" {
+		p, err = filepath.Abs(c.RootFSManifest)
+		if err != nil {
+			return fmt.Errorf("failed to get rootfs manifest absolute path from %s: %v", c.RootFSManifest, err)
+		}
+		c.RootFSManifest = p
+	}
+
 	version := types.Version{}
 	s := strings.Split(c.RunOpt.Version, ",")
 
@@ -143,23 +178,88 @@ func (c *RunContext) update() error {
 		return fmt.Errorf("failed to update: %w", err)
 	}
 
+	wsl.RegisterReadyFunc(func() {
+		if err := update.Commit(c.Logger, c.ImageDir); err != nil {
+			c.Logger.Warnf("Failed to commit update: %v", err)
+		}
+	})
+
 	return nil
 }
 
 // just a random port
 const podmanStartPort = 7591
 
+type podmanPortRecord struct {
+	Port int `json:"port"`
+}
+
+// setupPort uses the preferred port (--podman-port, or the port of the last run) if it is free,
+// otherwise falls back to a free port unless the fallback is disabled.
 func (c *RunContext) setupPort() error {
-	p, err := util.FindUsablePort(podmanStartPort)
-	if err != nil {
-		return fmt.Errorf("failed to find a usable port: %v", err)
+	recordPath := filepath.Join(c.ImageDir, "podman.json")
+
+	preferred := c.PreferredPodmanPort
+	if preferred == 0 {
+		if data, err := os.ReadFile(recordPath); err == nil {
+			var record podmanPortRecord
+			if err := json.Unmarshal(data, &record); err != nil {
+				c.Logger.Warnf("Failed to unmarshal %s: %v", recordPath, err)
+			} else {
+				preferred = record.Port
+			}
+		}
+	}
+
+	p := 0
+	if preferred != 0 {
+		if err := util.PortOccupied(preferred); err != nil {
+			if !c.PodmanPortFallback {
+				event.NotifyRun(event.PodmanPortOccupied, fmt.Sprintf("%d", preferred))
+				return fmt.Errorf("preferred podman port %d is taken and fallback is disabled: %w", preferred, err)
+			}
+
+			c.Logger.Warnf("Preferred podman port %d is taken, fallback to a free port: %v", preferred, err)
+		} else {
+			p = preferred
+		}
+	}
+
+	if p == 0 {
+		var err error
+		if p, err = util.FindUsablePort(podmanStartPort); err != nil {
+			return fmt.Errorf("failed to find a usable port: %v", err)
+		}
 	}
 
 	c.PodmanPort = p
+	c.Logger.Infof("Podman port is: %d", p)
+
+	if data, err := json.Marshal(&podmanPortRecord{Port: p}); err != nil {
+		c.Logger.Warnf("Failed to marshal podman port: %v", err)
+	} else if err := os.WriteFile(recordPath, data, 0644); err != nil {
+		c.Logger.Warnf("Failed to save podman port to %s: %v", recordPath, err)
+	}
 
 	return nil
 }
 
+// setupPortForward restores the port mappings of the last run
+func (c *RunContext) setupPortForward() {
+	p := ""
+	if configPath, ok := util.ConfigPath(); ok {
+		p = filepath.Join(configPath, c.Name+"_ports.json")
+	}
+
+	c.Ports = portforward.New(c.Logger, p, func(ctx context.Context, port int) (net.Conn, error) {
+		return wsl.DialGuest(ctx, c.Logger, c.DistroName, port)
+	}, c.PodmanPort)
+
+	if err := c.Ports.Restore(); err != nil {
+		c.Logger.Warnf("Failed to restore port mappings: %v", err)
+	}
+}
+
 func (c *RunContext) setupSourceCodeDisk() error {
 	if _, err := os.Stat(filepath.Join(c.ImageDir, "sourcecode.vhdx")); err == nil {
 		c.Logger.Info("source code disk already exists")
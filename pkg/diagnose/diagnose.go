@@ -0,0 +1,354 @@
+// SPDX-FileCopyrightText: 2025 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package diagnose
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/oomol-lab/ovm-win/pkg/logger"
+	"github.com/oomol-lab/ovm-win/pkg/types"
+	"github.com/oomol-lab/ovm-win/pkg/wsl"
+	"golang.org/x/sys/windows"
+)
+
+// Opt is the options of [Collect]
+type Opt struct {
+	Name    string
+	LogPath string
+	// ImageDir is optional, versions.json and the disk sizes are skipped if it is empty
+	ImageDir string
+}
+
+// Entry is a file in the bundle
+type Entry struct {
+	Path string `json:"path"`
+	// Source is the path on the host, empty if the content is generated
+	Source string `json:"source,omitempty"`
+	Size   int64  `json:"size"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Manifest is the `manifest.json` in the bundle
+type Manifest struct {
+	Name     string    `json:"name"`
+	ImageDir string    `json:"imageDir,omitempty"`
+	Time     time.Time `json:"time"`
+	Entries  []Entry   `json:"entries"`
+}
+
+type bundle struct {
+	log      *logger.Context
+	zw       *zip.Writer
+	manifest *Manifest
+}
+
+// Collect writes the diagnostic bundle of the VM to w as a zip archive.
+//
+// A failed item does not stop the collection, the error is recorded in the manifest instead.
+// The returned error is only about writing the archive.
+func Collect(log *logger.Context, opt *Opt, w io.Writer) (*Manifest, error) {
+	b := &bundle{
+		log: log,
+		zw:  zip.NewWriter(w),
+		manifest: &Manifest{
+			Name:     opt.Name,
+			ImageDir: opt.ImageDir,
+			Time:     time.Now(),
+		},
+	}
+
+	if err := b.logs(opt.LogPath, opt.Name); err != nil {
+		return nil, err
+	}
+
+	if opt.ImageDir != "" {
+		for _, name := range []string{"versions.json", "podman.json"} {
+			if err := b.addFile("image/"+name, filepath.Join(opt.ImageDir, name)); err != nil {
+				return nil, err
+			}
+		}
+
+		if err := b.addJSON("image/disks.json", func() (any, error) { return diskUsage(opt.ImageDir) }); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := b.add("wslconfig.txt", "", func() ([]byte, error) { return redactedWSLConfig() }); err != nil {
+		return nil, err
+	}
+
+	for _, c := range []struct {
+		name string
+		args []string
+	}{
+		{"wsl/status.txt", []string{"--status"}},
+		{"wsl/version.txt", []string{"--version"}},
+		{"wsl/list.txt", []string{"--list", "--verbose"}},
+	} {
+		args := c.args
+		if err := b.add(c.name, "", func() ([]byte, error) {
+			var out string
+			err := wsl.Exec(log).SetAllOut(&out).Run(args...)
+			// the output is still useful when wsl.exe exits with a non-zero code
+			return []byte(out), err
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := b.addJSON("doctor.json", func() (any, error) {
+		// never probe a distro here, collecting diagnostics must not boot the VM
+		return wsl.Doctor(&types.DoctorOpt{
+			BasicOpt: types.BasicOpt{
+				Name:   opt.Name,
+				Logger: log,
+			},
+		}), nil
+	}); err != nil {
+		return nil, err
+	}
+
+	data, err := json.MarshalIndent(b.manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	if err := b.write("manifest.json", data); err != nil {
+		return nil, err
+	}
+
+	if err := b.zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close zip: %w", err)
+	}
+
+	return b.manifest, nil
+}
+
+// write writes the content into the archive
+func (b *bundle) write(name string, data []byte) error {
+	f, err := b.zw.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create %s in zip: %w", name, err)
+	}
+
+	if _, err := f.Write(data); err != nil {
+		return fmt.Errorf("failed to write %s in zip: %w", name, err)
+	}
+
+	return nil
+}
+
+// add generates the content and writes it into the archive, the error of fn is recorded in the manifest
+func (b *bundle) add(name, source string, fn func() ([]byte, error)) error {
+	e := Entry{
+		Path:   name,
+		Source: source,
+	}
+
+	data, err := fn()
+	if err != nil {
+		b.log.Warnf("Diagnose: failed to collect %s: %v", name, err)
+		e.Error = err.Error()
+	}
+
+	if len(data) != 0 {
+		if err := b.write(name, data); err != nil {
+			return err
+		}
+		e.Size = int64(len(data))
+	}
+
+	b.manifest.Entries = append(b.manifest.Entries, e)
+	return nil
+}
+
+func (b *bundle) addFile(name, p string) error {
+	return b.add(name, p, func() ([]byte, error) {
+		return os.ReadFile(p)
+	})
+}
+
+func (b *bundle) addJSON(name string, fn func() (any, error)) error {
+	return b.add(name, "", func() ([]byte, error) {
+		// the partial result is kept along with the error
+		v, err := fn()
+		if v == nil {
+			return nil, err
+		}
+
+		data, jsonErr := json.MarshalIndent(v, "", "  ")
+		if jsonErr != nil {
+			return nil, jsonErr
+		}
+		return data, err
+	})
+}
+
+// logs adds all the log generations of the VM, including the rotated and compressed ones
+func (b *bundle) logs(logPath, name string) error {
+	entries, err := os.ReadDir(logPath)
+	if err != nil {
+		return b.add("logs/", logPath, func() ([]byte, error) { return nil, err })
+	}
+
+	for _, e := range entries {
+		if e.IsDir() || !isLogOf(e.Name(), name) {
+			continue
+		}
+
+		if err := b.addFile("logs/"+e.Name(), filepath.Join(logPath, e.Name())); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// logFile matches the log files and the rotated ones, such as `foo.log`, `foo.2.log` and `foo.2.log.gz`,
+// and the event spool files, the first group is the logger name
+var logFile = regexp.MustCompile(`(?i)^(.+?)(?:\.\d+)?\.log(?:\.gz)?$|^(.+)\.spool$`)
+
+// logPrefixes and logSuffixes are added to the VM name by the loggers of the commands and the spool files
+var (
+	logPrefixes = []string{"init-", "doctor-", "diagnose-", "migrate"}
+	logSuffixes = []string{"-vm", "-dism", "-update-wsl", "-events"}
+)
+
+// isLogOf reports whether the file belongs to the VM, such as `foo.log`, `foo-vm.2.log.gz`, `init-foo.log`,
+// `foo-dism.log` and `foo-events.spool`, but not the logs of another VM `foo-bar`.
+func isLogOf(file, name string) bool {
+	m := logFile.FindStringSubmatch(file)
+	if m == nil {
+		return false
+	}
+
+	stem := m[1] + m[2]
+	for _, prefix := range logPrefixes {
+		if len(stem) > len(prefix) && strings.EqualFold(stem[:len(prefix)], prefix) {
+			stem = stem[len(prefix):]
+			break
+		}
+	}
+
+	if strings.EqualFold(stem, name) {
+		return true
+	}
+
+	for _, suffix := range logSuffixes {
+		if len(stem) > len(suffix) && strings.EqualFold(stem[len(stem)-len(suffix):], suffix) && strings.EqualFold(stem[:len(stem)-len(suffix)], name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type diskFile struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+type disks struct {
+	Files []diskFile `json:"files"`
+	Total int64      `json:"total"`
+	// Free is the free space of the volume that contains the image directory
+	Free uint64 `json:"free"`
+}
+
+func diskUsage(imageDir string) (*disks, error) {
+	d := &disks{}
+
+	err := filepath.WalkDir(imageDir, func(p string, e os.DirEntry, err error) error {
+		if err != nil || e.IsDir() {
+			return err
+		}
+
+		info, err := e.Info()
+		if err != nil {
+			return err
+		}
+
+		rel, _ := filepath.Rel(imageDir, p)
+		d.Files = append(d.Files, diskFile{Name: filepath.ToSlash(rel), Size: info.Size()})
+		d.Total += info.Size()
+		return nil
+	})
+	if err != nil {
+		return d, fmt.Errorf("failed to walk %s: %w", imageDir, err)
+	}
+
+	p, err := windows.UTF16PtrFromString(imageDir)
+	if err != nil {
+		return d, fmt.Errorf("failed to convert %s: %w", imageDir, err)
+	}
+	if err := windows.GetDiskFreeSpaceEx(p, &d.Free, nil, nil); err != nil {
+		return d, fmt.Errorf("failed to get free space of %s: %w", imageDir, err)
+	}
+
+	return d, nil
+}
+
+var sensitiveKey = regexp.MustCompile(`(?i)(proxy|password|passwd|token|secret|credential|auth)`)
+
+// redactedWSLConfig returns the .wslconfig with the sensitive values replaced and the user name removed
+func redactedWSLConfig() ([]byte, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user home dir: %w", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(home, ".wslconfig"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []byte("# .wslconfig does not exist\n"), nil
+		}
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if k, _, ok := strings.Cut(line, "="); ok && sensitiveKey.MatchString(k) && !isComment(line) {
+			line = k + "= <redacted>"
+		}
+
+		// the paths, such as kernel and swapFile, contain the user name
+		line = replaceFold(line, home, "%USERPROFILE%")
+		line = replaceFold(line, strings.ReplaceAll(home, `\`, `\\`), "%USERPROFILE%")
+
+		out.WriteString(line)
+		out.WriteByte('\n')
+	}
+
+	return out.Bytes(), scanner.Err()
+}
+
+func isComment(line string) bool {
+	line = strings.TrimSpace(line)
+	return strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";")
+}
+
+// replaceFold replaces all the old in s case-insensitively, Windows paths are case-insensitive
+func replaceFold(s, old, new string) string {
+	if old == "" {
+		return s
+	}
+
+	return regexp.MustCompile(`(?i)`+regexp.QuoteMeta(old)).ReplaceAllLiteralString(s, new)
+}
@@ -0,0 +1,44 @@
+// SPDX-FileCopyrightText: 2025 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package diagnose
+
+import "testing"
+
+func TestIsLogOf(t *testing.T) {
+	tests := []struct {
+		file string
+		want bool
+	}{
+		{"foo.log", true},
+		{"foo.2.log", true},
+		{"foo.3.log.gz", true},
+		{"foo-vm.log", true},
+		{"foo-vm.2.log.gz", true},
+		{"foo-dism.log", true},
+		{"foo-update-wsl.log", true},
+		{"foo-events.spool", true},
+		{"init-foo.log", true},
+		{"init-foo-events.spool", true},
+		{"doctor-foo.log", true},
+		{"diagnose-foo.log", true},
+		{"migratefoo.log", true},
+		{"FOO.log", true},
+
+		{"foo-bar.log", false},
+		{"foo-bar-vm.log", false},
+		{"foo-bar-events.spool", false},
+		{"init-foo-bar.log", false},
+		{"foobar.log", false},
+		{"bar.log", false},
+		{"foo.txt", false},
+		{"foo.logs", false},
+		{"foo", false},
+	}
+
+	for _, tt := range tests {
+		if got := isLogOf(tt.file, "foo"); got != tt.want {
+			t.Errorf("isLogOf(%q, \"foo\") = %v, want %v", tt.file, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+// SPDX-FileCopyrightText: 2025 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package initstate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/oomol-lab/ovm-win/pkg/logger"
+)
+
+type State string
+
+const (
+	Checking                 State = "Checking"
+	SystemNotSupport         State = "SystemNotSupport"
+	NeedUpdateWSL            State = "NeedUpdateWSL"
+	UpdatingWSL              State = "UpdatingWSL"
+	NeedEnableFeature        State = "NeedEnableFeature"
+	EnablingFeature          State = "EnablingFeature"
+	NeedReboot               State = "NeedReboot"
+	NotSupportVirtualization State = "NotSupportVirtualization"
+	WSLConfigIncompatible    State = "WSLConfigIncompatible"
+	FixingWSLConfig          State = "FixingWSLConfig"
+	WaitingWSLShutdown       State = "WaitingWSLShutdown"
+	Passed                   State = "Passed"
+)
+
+// transitions is the legal transitions of the init flow
+//
+// Checking -> EnablingFeature is only used by the elevated process, which starts enabling the feature directly.
+var transitions = map[State][]State{
+	Checking:              {SystemNotSupport, NeedUpdateWSL, NeedEnableFeature, EnablingFeature, NotSupportVirtualization, WSLConfigIncompatible, Passed},
+	NeedUpdateWSL:         {UpdatingWSL},
+	UpdatingWSL:           {NeedUpdateWSL, Checking},
+	NeedEnableFeature:     {EnablingFeature},
+	EnablingFeature:       {NeedEnableFeature, NeedReboot},
+	WSLConfigIncompatible: {FixingWSLConfig},
+	FixingWSLConfig:       {WSLConfigIncompatible, WaitingWSLShutdown, Passed},
+	WaitingWSLShutdown:    {Passed},
+}
+
+var ErrIllegalTransition = errors.New("illegal state transition")
+var ErrStateMismatch = errors.New("current state mismatch")
+
+// Snapshot is the persisted and queryable form of the [Machine]
+type Snapshot struct {
+	State     State     `json:"state"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	BootTime  time.Time `json:"bootTime"`
+}
+
+// Machine is the state machine of the init flow.
+//
+// It is safe for concurrent use, every transition is persisted to the state file (if any),
+// so the flow can be resumed after the process restarts, see [Machine.Resume].
+type Machine struct {
+	log      *logger.Context
+	path     string
+	bootTime time.Time
+
+	mu      sync.Mutex
+	current Snapshot
+	changed chan struct{}
+}
+
+// New creates a state machine in the [Checking] state, path is the state file, empty means not persisted
+func New(log *logger.Context, path string, bootTime time.Time) *Machine {
+	return &Machine{
+		log:      log,
+		path:     path,
+		bootTime: bootTime,
+		current: Snapshot{
+			State:     Checking,
+			UpdatedAt: time.Now(),
+			BootTime:  bootTime,
+		},
+		changed: make(chan struct{}),
+	}
+}
+
+// Resume restores the state from the state file.
+//
+// Only [NeedReboot] is restored, and only if the system has not been rebooted since it was persisted,
+// because all other states are re-detected by the checks.
+func (m *Machine) Resume() (State, bool) {
+	if m.path == "" {
+		return "", false
+	}
+
+	data, err := os.ReadFile(m.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			m.log.Warnf("Failed to read init state file: %v", err)
+		}
+		return "", false
+	}
+
+	var s Snapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		m.log.Warnf("Failed to unmarshal init state file, content: %s, %v", data, err)
+		return "", false
+	}
+
+	m.log.Infof("Persisted init state is %s, updated at %s, boot time %s", s.State, s.UpdatedAt, s.BootTime)
+
+	if s.State != NeedReboot {
+		return "", false
+	}
+
+	// The boot time is calculated from the uptime, so there is a slight deviation
+	if d := m.bootTime.Sub(s.BootTime).Abs(); d > time.Minute {
+		m.log.Info("System has been rebooted, no need to resume")
+		return "", false
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.set(s.State)
+	return s.State, true
+}
+
+// Current returns the current state
+func (m *Machine) Current() State {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.current.State
+}
+
+// Snapshot returns the current state and when it was entered
+func (m *Machine) Snapshot() Snapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.current
+}
+
+// To moves to the state, if the transition is legal
+func (m *Machine) To(to State) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.to(to)
+}
+
+// Swap moves to the state only if the current state is from.
+//
+// It is used to claim an action, e.g. only one of the concurrent requests can move [NeedUpdateWSL] to [UpdatingWSL].
+func (m *Machine) Swap(from, to State) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.current.State != from {
+		return fmt.Errorf("%w: expect %s, but current is %s", ErrStateMismatch, from, m.current.State)
+	}
+
+	return m.to(to)
+}
+
+// Wait blocks until the current state is one of the states, or the ctx is done
+func (m *Machine) Wait(ctx context.Context, states ...State) (State, error) {
+	for {
+		m.mu.Lock()
+		current, changed := m.current.State, m.changed
+		m.mu.Unlock()
+
+		if slices.Contains(states, current) {
+			return current, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return current, context.Cause(ctx)
+		case <-changed:
+		}
+	}
+}
+
+func (m *Machine) to(to State) error {
+	from := m.current.State
+	if !slices.Contains(transitions[from], to) {
+		return fmt.Errorf("%w: %s -> %s", ErrIllegalTransition, from, to)
+	}
+
+	m.log.Infof("Init state: %s -> %s", from, to)
+	m.set(to)
+	return nil
+}
+
+func (m *Machine) set(to State) {
+	m.current = Snapshot{
+		State:     to,
+		UpdatedAt: time.Now(),
+		BootTime:  m.bootTime,
+	}
+
+	close(m.changed)
+	m.changed = make(chan struct{})
+
+	m.save()
+}
+
+func (m *Machine) save() {
+	if m.path == "" {
+		return
+	}
+
+	data, err := json.Marshal(m.current)
+	if err != nil {
+		m.log.Warnf("Failed to marshal init state: %v", err)
+		return
+	}
+
+	if err := os.WriteFile(m.path, data, 0644); err != nil {
+		m.log.Warnf("Failed to write init state to %s: %v", m.path, err)
+	}
+}
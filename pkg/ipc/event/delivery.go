@@ -0,0 +1,208 @@
+// SPDX-FileCopyrightText: 2025 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package event
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// Policy is the delivery policy of an event.
+//
+// An event is delivered when the client responds 200, which is the acknowledgement.
+type Policy struct {
+	// Retries is the number of retries after the first delivery failed
+	Retries int
+	// Spool writes the event to the spool file if it still cannot be delivered,
+	// it will be delivered again when the next process starts.
+	Spool bool
+}
+
+const retryBackoff = 100 * time.Millisecond
+
+// SpooledName is the name of the events spooled by the previous process, the value is the original event as JSON,
+// such as {"seq":3,"stage":"run","name":"Exit","value":"","time":"..."}.
+//
+// They are never delivered under their original names, so a spooled Exit is not mistaken for the exit of this process.
+const SpooledName = "Spooled"
+
+var defaultPolicy = Policy{
+	Retries: 2,
+	Spool:   false,
+}
+
+// policyKey is the stage and the name, the init and run stages have events with the same name, such as Exit
+type policyKey struct {
+	stage stage
+	name  string
+}
+
+var (
+	policyMux sync.RWMutex
+	policies  = map[policyKey]Policy{
+		{kInit, string(InitExit)}:   {Retries: 5, Spool: true},
+		{kInit, string(NeedReboot)}: {Retries: 5, Spool: true},
+		{kInit, string(InitError)}:  {Retries: 3, Spool: true},
+		{kRun, string(RunExit)}:     {Retries: 5, Spool: true},
+		{kRun, string(RunError)}:    {Retries: 3, Spool: true},
+		{kRun, string(Ready)}:       {Retries: 5, Spool: false},
+	}
+)
+
+// SetInitPolicy sets the delivery policy of the init event
+func SetInitPolicy(name nameInit, p Policy) {
+	setPolicy(kInit, string(name), p)
+}
+
+// SetRunPolicy sets the delivery policy of the run event
+func SetRunPolicy(name nameRun, p Policy) {
+	setPolicy(kRun, string(name), p)
+}
+
+func setPolicy(s stage, name string, p Policy) {
+	policyMux.Lock()
+	defer policyMux.Unlock()
+
+	policies[policyKey{s, name}] = p
+}
+
+func policyOf(s stage, name string) Policy {
+	policyMux.RLock()
+	defer policyMux.RUnlock()
+
+	if p, ok := policies[policyKey{s, name}]; ok {
+		return p
+	}
+
+	return defaultPolicy
+}
+
+// send delivers the event with retries, and spools it if the policy allows
+func (e *event) send(d *datum) {
+	p := policyOf(stage(d.Stage), d.Name)
+
+	backoff := retryBackoff
+	for i := 0; ; i++ {
+		err := e.deliver(d)
+		if err == nil {
+			return
+		}
+
+		e.log.Warnf("Notify %+v event failed (%d/%d): %v", d.Record, i+1, p.Retries+1, err)
+
+		if i >= p.Retries {
+			break
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+
+	if p.Spool {
+		e.spool(d)
+	}
+}
+
+func (e *event) deliver(d *datum) error {
+	q := url.Values{}
+	q.Set("stage", d.Stage)
+	q.Set("name", d.Name)
+	q.Set("value", d.Value)
+	q.Set("seq", fmt.Sprintf("%d", d.Seq))
+	q.Set("time", fmt.Sprintf("%d", d.Time.UnixMilli()))
+	if d.spooled {
+		original, _ := json.Marshal(d.Record)
+		q.Set("name", SpooledName)
+		q.Set("value", string(original))
+		q.Set("spooled", "true")
+	}
+
+	uri := "http://ovm/notify?" + q.Encode()
+	e.log.Infof("Notify %s event to %s", d.Name, uri)
+
+	resp, err := e.client.Get(uri)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status code is: %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+func (e *event) spool(d *datum) {
+	if e.spoolPath == "" {
+		return
+	}
+
+	data, err := json.Marshal(d.Record)
+	if err != nil {
+		e.log.Warnf("Failed to marshal %+v event to spool: %v", d.Record, err)
+		return
+	}
+
+	f, err := os.OpenFile(e.spoolPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		e.log.Warnf("Failed to open spool file %s: %v", e.spoolPath, err)
+		return
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		e.log.Warnf("Failed to write %+v event to spool: %v", d.Record, err)
+		return
+	}
+
+	e.log.Infof("Event %s is spooled to %s", d.Name, e.spoolPath)
+}
+
+// loadSpool reads and removes the spool file.
+//
+// The spooled events keep their seq, and the seq of the new events continues after them, so they never collide.
+func (e *event) loadSpool() []*datum {
+	if e.spoolPath == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(e.spoolPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			e.log.Warnf("Failed to read spool file %s: %v", e.spoolPath, err)
+		}
+		return nil
+	}
+
+	if err := os.Remove(e.spoolPath); err != nil {
+		e.log.Warnf("Failed to remove spool file %s: %v", e.spoolPath, err)
+	}
+
+	var list []*datum
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			e.log.Warnf("Failed to unmarshal spooled event %s: %v", scanner.Text(), err)
+			continue
+		}
+
+		list = append(list, &datum{
+			Record:  r,
+			spooled: true,
+		})
+		h.continueAfter(r.Seq)
+	}
+
+	e.log.Infof("Loaded %d spooled events from %s", len(list), e.spoolPath)
+	return list
+}
@@ -5,14 +5,11 @@ package event
 
 import (
 	"context"
-	"fmt"
 	"net"
 	"net/http"
-	"net/url"
 	"time"
 
 	"github.com/Code-Hex/go-infinity-channel"
-	"github.com/Microsoft/go-winio"
 	"github.com/oomol-lab/ovm-win/pkg/logger"
 )
 
@@ -51,27 +48,62 @@ const (
 	UpdatingRootFS      nameRun = "UpdatingRootFS"
 	UpdateRootFSFailed  nameRun = "UpdateRootFSFailed"
 	UpdateRootFSSuccess nameRun = "UpdateRootFSSuccess"
+	// RootFSInvalid carries the reason why the rootfs archive is rejected, such as a checksum mismatch
+	RootFSInvalid nameRun = "RootFSInvalid"
 
 	UpdatingData      nameRun = "UpdatingData"
 	UpdateDataFailed  nameRun = "UpdateDataFailed"
 	UpdateDataSuccess nameRun = "UpdateDataSuccess"
 
+	// RollingBack means the update has not reached Ready, the previous rootfs and data are being restored
+	RollingBack     nameRun = "RollingBack"
+	RollbackFailed  nameRun = "RollbackFailed"
+	RollbackSuccess nameRun = "RollbackSuccess"
+
+	// DataMigrating carries the plan, such as {"from":"1","to":"3","steps":["..."],"dryRun":false}
+	DataMigrating nameRun = "DataMigrating"
+	// DataMigrationStep carries the step, such as {"index":1,"total":2,"from":"1","to":"2","name":"..."}
+	DataMigrationStep       nameRun = "DataMigrationStep"
+	DataMigrationStepFailed nameRun = "DataMigrationStepFailed"
+	DataMigrationSuccess    nameRun = "DataMigrationSuccess"
+	// DataMigrationDryRunFinished means the dry run has finished without any change, the process exits after it
+	DataMigrationDryRunFinished nameRun = "DataMigrationDryRunFinished"
+	// DowngradeRefused carries the version older than versions.json, such as {"key":"rootfs","from":"1.1","to":"1.0"}
+	DowngradeRefused nameRun = "DowngradeRefused"
+
+	// DataRecreateRequired means there is no migration path, the data can only be recreated with --allow-data-recreate
+	DataRecreateRequired nameRun = "DataRecreateRequired"
+
+	PodmanPortOccupied nameRun = "PodmanPortOccupied"
+	// PodmanUnreachable means podman cannot be connected
+	PodmanUnreachable nameRun = "PodmanUnreachable"
+	// PodmanError means podman is reachable, but it responds an error
+	PodmanError nameRun = "PodmanError"
+
 	Starting nameRun = "Starting"
+	// Progress carries the phase reported by ovmd, such as {"phase":"ready","progress":100}
+	Progress nameRun = "Progress"
 	Ready    nameRun = "Ready"
 	RunExit  nameRun = "Exit"
 	RunError nameRun = "Error"
+
+	Restarting nameRun = "Restarting"
+	Recovered  nameRun = "Recovered"
+	GaveUp     nameRun = "GaveUp"
 )
 
 type datum struct {
-	stage stage
-	name  string
-	value string
+	Record
+
+	// spooled is true if the event is loaded from the spool file, which is written by the previous process
+	spooled bool
 }
 
 type event struct {
-	client  *http.Client
-	log     *logger.Context
-	channel *infinity.Channel[*datum]
+	client    *http.Client
+	log       *logger.Context
+	channel   *infinity.Channel[*datum]
+	spoolPath string
 }
 
 var e *event
@@ -79,37 +111,38 @@ var e *event
 // see: https://github.com/Code-Hex/go-infinity-channel/issues/1
 var waitDone = make(chan struct{})
 
-func Setup(log *logger.Context, socketPath string) {
+// Setup starts delivering the events to the HTTP server in the socketPath.
+//
+// The events that cannot be delivered are spooled to the spoolPath (if the policy allows),
+// and will be delivered first on the next Setup.
+func Setup(log *logger.Context, socketPath, spoolPath string) {
 	c := &http.Client{
 		Transport: &http.Transport{
 			DialContext: func(ctx context.Context, _, addr string) (net.Conn, error) {
-				return winio.DialPipeContext(ctx, socketPath)
+				return dialPipe(ctx, socketPath)
 			},
 		},
 		Timeout: 200 * time.Millisecond,
 	}
 
 	e = &event{
-		client:  c,
-		log:     log,
-		channel: infinity.NewChannel[*datum](),
+		client:    c,
+		log:       log,
+		channel:   infinity.NewChannel[*datum](),
+		spoolPath: spoolPath,
 	}
 
+	spooled := e.loadSpool()
+
 	go func() {
-		for datum := range e.channel.Out() {
-			uri := fmt.Sprintf("http://ovm/notify?stage=%s&name=%s&value=%s", datum.stage, url.QueryEscape(datum.name), url.QueryEscape(datum.value))
-			e.log.Infof("Notify %s event to %s", datum.name, uri)
-
-			if resp, err := e.client.Get(uri); err != nil {
-				e.log.Warnf("Notify %+v event failed: %v", *datum, err)
-			} else {
-				_ = resp.Body.Close()
-				if resp.StatusCode != http.StatusOK {
-					e.log.Warnf("Notify %+v event failed, status code is: %d", *datum, resp.StatusCode)
-				}
-			}
+		for _, d := range spooled {
+			e.send(d)
+		}
+
+		for d := range e.channel.Out() {
+			e.send(d)
 
-			if datum.name == "Exit" || datum.name == string(NeedReboot) {
+			if d.Name == "Exit" || d.Name == string(NeedReboot) {
 				waitDone <- struct{}{}
 				return
 			}
@@ -130,9 +163,7 @@ func notify(c stage, name string, value ...string) {
 	}
 
 	e.channel.In() <- &datum{
-		stage: c,
-		name:  name,
-		value: v,
+		Record: record(c, name, v),
 	}
 
 	// wait for the event to be processed
@@ -0,0 +1,177 @@
+// SPDX-FileCopyrightText: 2025 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package event
+
+import (
+	"sync"
+	"time"
+)
+
+// Record is an event that has been notified in the current process
+type Record struct {
+	Seq   uint64    `json:"seq"`
+	Stage string    `json:"stage"`
+	Name  string    `json:"name"`
+	Value string    `json:"value"`
+	Time  time.Time `json:"time"`
+}
+
+const (
+	// maxHistory is the number of the latest events kept for replaying
+	maxHistory = 1024
+	// maxQueue is the number of events a subscriber can fall behind, it is dropped if exceeded
+	maxQueue = 1024
+)
+
+type hub struct {
+	mu  sync.Mutex
+	seq uint64
+	// history is a ring buffer of the latest events, the oldest one is at start
+	history [maxHistory]Record
+	start   int
+	size    int
+	subs    map[*Subscription]struct{}
+}
+
+var h = &hub{
+	subs: make(map[*Subscription]struct{}),
+}
+
+func record(s stage, name, value string) Record {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.seq++
+	r := Record{
+		Seq:   h.seq,
+		Stage: string(s),
+		Name:  name,
+		Value: value,
+		Time:  time.Now(),
+	}
+
+	if h.size < maxHistory {
+		h.history[(h.start+h.size)%maxHistory] = r
+		h.size++
+	} else {
+		h.history[h.start] = r
+		h.start = (h.start + 1) % maxHistory
+	}
+
+	for sub := range h.subs {
+		if !sub.push(r) {
+			delete(h.subs, sub)
+		}
+	}
+
+	return r
+}
+
+// continueAfter makes the seq of the following events greater than seq
+func (h *hub) continueAfter(seq uint64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.seq = max(h.seq, seq)
+}
+
+// after returns the kept events whose seq is greater than seq,
+// missed is the number of the events after seq which are no longer kept, the caller must hold the lock
+func (h *hub) after(seq uint64) (list []Record, missed uint64) {
+	for i := 0; i < h.size; i++ {
+		r := h.history[(h.start+i)%maxHistory]
+		if r.Seq > seq {
+			list = append(list, r)
+		}
+	}
+
+	if len(list) != 0 && list[0].Seq > seq+1 {
+		missed = list[0].Seq - seq - 1
+	}
+
+	return list, missed
+}
+
+// Subscription receives the events notified after [Subscribe].
+//
+// Every subscription has its own queue, a slow subscriber never blocks the notifier or the other subscribers,
+// but it is dropped once it falls behind maxQueue events (see [Subscription.Dropped]).
+type Subscription struct {
+	// History is the kept events after the seq passed to [Subscribe], before the subscription
+	History []Record
+	// Missed is the number of events after the seq which are no longer kept in the history
+	Missed uint64
+
+	mu      sync.Mutex
+	queue   []Record
+	ready   chan struct{}
+	dropped chan struct{}
+}
+
+// Subscribe returns a subscription of the following events, with the kept events after the seq as history,
+// 0 means from the beginning.
+//
+// The Close must be called when the subscriber is no longer interested in the events.
+func Subscribe(after uint64) *Subscription {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	sub := &Subscription{
+		ready:   make(chan struct{}, 1),
+		dropped: make(chan struct{}),
+	}
+	sub.History, sub.Missed = h.after(after)
+	h.subs[sub] = struct{}{}
+
+	return sub
+}
+
+// push queues the event, it returns false if the subscriber has fallen too far behind and is dropped
+func (s *Subscription) push(r Record) bool {
+	s.mu.Lock()
+	if len(s.queue) >= maxQueue {
+		s.queue = nil
+		s.mu.Unlock()
+		close(s.dropped)
+		return false
+	}
+	s.queue = append(s.queue, r)
+	s.mu.Unlock()
+
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+
+	return true
+}
+
+// Ready is signaled when there are new events, call [Subscription.Next] to take them
+func (s *Subscription) Ready() <-chan struct{} {
+	return s.ready
+}
+
+// Dropped is closed when the subscriber has fallen too far behind, no more events will be received,
+// it should subscribe again from the last seq it has handled
+func (s *Subscription) Dropped() <-chan struct{} {
+	return s.dropped
+}
+
+// Next takes the queued events in order
+func (s *Subscription) Next() []Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := s.queue
+	s.queue = nil
+	return list
+}
+
+// Close stops receiving the events
+func (s *Subscription) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.subs, s)
+}
@@ -0,0 +1,77 @@
+// SPDX-FileCopyrightText: 2025 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package event
+
+import "testing"
+
+func resetHub(t *testing.T) {
+	h = &hub{
+		subs: make(map[*Subscription]struct{}),
+	}
+	t.Cleanup(func() {
+		h = &hub{
+			subs: make(map[*Subscription]struct{}),
+		}
+	})
+}
+
+func TestHistoryIsCapped(t *testing.T) {
+	resetHub(t)
+
+	for i := 0; i < maxHistory+10; i++ {
+		record(kRun, string(Ready), "")
+	}
+
+	sub := Subscribe(0)
+	defer sub.Close()
+
+	if len(sub.History) != maxHistory {
+		t.Fatalf("len(History) = %d, want %d", len(sub.History), maxHistory)
+	}
+	if first := sub.History[0].Seq; first != 11 {
+		t.Errorf("first seq = %d, want 11", first)
+	}
+	if sub.Missed != 10 {
+		t.Errorf("Missed = %d, want 10", sub.Missed)
+	}
+
+	resumed := Subscribe(maxHistory)
+	defer resumed.Close()
+
+	if len(resumed.History) != 10 || resumed.Missed != 0 {
+		t.Errorf("Subscribe(%d) = %d events, %d missed, want 10 events, 0 missed", maxHistory, len(resumed.History), resumed.Missed)
+	}
+}
+
+func TestSlowSubscriberIsDropped(t *testing.T) {
+	resetHub(t)
+
+	slow := Subscribe(0)
+	defer slow.Close()
+	fast := Subscribe(0)
+	defer fast.Close()
+
+	for i := 0; i < maxQueue+1; i++ {
+		record(kRun, string(Ready), "")
+		if i < maxQueue {
+			fast.Next()
+		}
+	}
+
+	select {
+	case <-slow.Dropped():
+	default:
+		t.Fatal("slow subscriber is not dropped")
+	}
+
+	select {
+	case <-fast.Dropped():
+		t.Fatal("fast subscriber is dropped")
+	default:
+	}
+
+	if list := fast.Next(); len(list) != 1 || list[0].Seq != maxQueue+1 {
+		t.Errorf("fast subscriber got %v, want the last event", list)
+	}
+}
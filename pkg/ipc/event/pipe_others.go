@@ -0,0 +1,17 @@
+// SPDX-FileCopyrightText: 2025 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+//go:build !windows
+
+package event
+
+import (
+	"context"
+	"net"
+)
+
+// dialPipe connects to a unix socket instead of the named pipe on other platforms, it is only used by the tests
+func dialPipe(ctx context.Context, path string) (net.Conn, error) {
+	var d net.Dialer
+	return d.DialContext(ctx, "unix", path)
+}
@@ -0,0 +1,26 @@
+// SPDX-FileCopyrightText: 2025 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package restful
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/oomol-lab/ovm-win/pkg/diagnose"
+)
+
+// diagnostics streams the diagnostic bundle as a zip file, see `ovm diagnose`
+func (r *routerRun) diagnostics(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("diagnose-%s.zip", r.opt.Name)))
+
+	// the status code has been sent once the content is written, the client sees a broken zip on failure
+	if _, err := diagnose.Collect(r.log, &diagnose.Opt{
+		Name:     r.opt.Name,
+		LogPath:  r.opt.LogPath,
+		ImageDir: r.opt.ImageDir,
+	}, w); err != nil {
+		r.log.Warnf("Failed to collect diagnostics: %v", err)
+	}
+}
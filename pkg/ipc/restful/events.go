@@ -0,0 +1,69 @@
+// SPDX-FileCopyrightText: 2025 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package restful
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/oomol-lab/ovm-win/pkg/ipc/event"
+	"github.com/oomol-lab/ovm-win/pkg/logger"
+)
+
+// events streams the lifecycle events as server-sent events.
+//
+// The kept events are replayed first (or those after the Last-Event-ID header), a `Missed` event carries the number
+// of the events which are no longer kept, then the new events are streamed until the client closes the connection.
+// The connection is closed if the client falls too far behind, it should reconnect with the Last-Event-ID header.
+func events(log *logger.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		sse, ok := newSSE(w)
+		if !ok {
+			log.Warnf("Bowser does not support server-sent events")
+			return
+		}
+
+		var lastID uint64
+		if id := req.Header.Get("Last-Event-ID"); id != "" {
+			lastID, _ = strconv.ParseUint(id, 10, 64)
+		}
+
+		sub := event.Subscribe(lastID)
+		defer sub.Close()
+
+		send := func(r event.Record) {
+			data, _ := json.Marshal(r)
+			sse.SendWithID(strconv.FormatUint(r.Seq, 10), r.Name, string(data))
+		}
+
+		if sub.Missed != 0 {
+			log.Warnf("Events client missed %d events after %d, they are no longer kept", sub.Missed, lastID)
+			sse.Send("Missed", strconv.FormatUint(sub.Missed, 10))
+		}
+
+		for _, r := range sub.History {
+			send(r)
+		}
+
+		for {
+			select {
+			case <-sub.Ready():
+				for _, r := range sub.Next() {
+					send(r)
+				}
+			case <-sub.Dropped():
+				// the client reconnects with Last-Event-ID, and continues from the history
+				log.Warn("Events client falls too far behind, close the connection")
+				return
+			case <-req.Context().Done():
+				log.Info("Events client closed connection")
+				return
+			case <-time.After(3 * time.Second):
+				sse.Ping()
+			}
+		}
+	}
+}
@@ -0,0 +1,193 @@
+// SPDX-FileCopyrightText: 2024-2025 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package restful
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/oomol-lab/ovm-win/pkg/util"
+	"github.com/oomol-lab/ovm-win/pkg/wsl"
+)
+
+// defaultMaxOutput is the default max bytes kept of each output stream
+const defaultMaxOutput = 4 << 20
+
+type execBody struct {
+	Command string `json:"command"`
+	// MaxOutput is the max bytes of each output stream, the rest is discarded and the stream is marked as truncated
+	MaxOutput int `json:"maxOutput"`
+	// Detached keeps the job running after the client closed connection,
+	// it can be followed again with `/exec/jobs/{id}/logs`
+	Detached bool `json:"detached"`
+}
+
+type execResult struct {
+	ExitCode int `json:"exitCode"`
+	// Signal is the signal number that terminated the command, 0 if it exited normally
+	Signal int `json:"signal,omitempty"`
+	// Duration is the wall-clock milliseconds of the command
+	Duration        int64  `json:"duration"`
+	StdoutTruncated bool   `json:"stdoutTruncated"`
+	StderrTruncated bool   `json:"stderrTruncated"`
+	Error           string `json:"error,omitempty"`
+
+	// Stdout and Stderr are only returned in the non-streaming mode
+	Stdout *string `json:"stdout,omitempty"`
+	Stderr *string `json:"stderr,omitempty"`
+}
+
+type execEvent struct {
+	name string
+	data string
+}
+
+// exec runs the command in the distro as a job.
+//
+// By default, the `job` event carries the job ID, then the output is streamed as `stdout` and `stderr` events,
+// and the `done` event carries the result.
+// With `?stream=false`, the whole result is returned as a single JSON document.
+func (r *routerRun) exec(w http.ResponseWriter, req *http.Request) {
+	var body execBody
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		r.log.Warnf("Failed to decode request body: %v", err)
+		http.Error(w, "failed to decode request body", http.StatusBadRequest)
+		return
+	}
+
+	if body.MaxOutput <= 0 {
+		body.MaxOutput = defaultMaxOutput
+	}
+
+	j, err := r.jobs.start(r, &body)
+	if err != nil {
+		r.log.Warnf("Failed to start exec job: %v", err)
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+
+	w.Header().Set("X-Job-Id", j.id)
+
+	if req.URL.Query().Get("stream") == "false" {
+		select {
+		case <-j.done:
+		case <-req.Context().Done():
+			r.log.Warnf("Client closed connection")
+			if !j.detached {
+				j.stop()
+			}
+			return
+		}
+
+		res := *j.info().Result
+		o, e := j.output("stdout"), j.output("stderr")
+		res.Stdout, res.Stderr = &o, &e
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(&res)
+		return
+	}
+
+	sse, ok := newSSE(w)
+	if !ok {
+		r.log.Warnf("Bowser does not support server-sent events")
+		return
+	}
+
+	sse.Send("job", j.id)
+
+	if !follow(req.Context(), sse, j, 0) {
+		r.log.Warnf("Client closed connection")
+		if !j.detached {
+			j.stop()
+		}
+	}
+}
+
+func runExec(ctx context.Context, r *routerRun, body *execBody, stdout, stderr io.Writer) *execResult {
+	res := &execResult{}
+	start := time.Now()
+	defer func() {
+		res.Duration = time.Since(start).Milliseconds()
+	}()
+
+	cf := filepath.Join(os.TempDir(), fmt.Sprintf("ovm-exec-%d.sh", time.Now().UnixNano()))
+	if err := os.WriteFile(cf, []byte(body.Command), 0o644); err != nil {
+		res.Error = fmt.Sprintf("failed to write command to file: %v", err)
+		return res
+	}
+	defer func() {
+		_ = os.Remove(cf)
+	}()
+
+	out := limitWriter(stdout, body.MaxOutput)
+	errOut := limitWriter(stderr, body.MaxOutput)
+
+	err := wsl.Invoke(ctx, r.log, r.opt.DistroName, nil, out, errOut, "sh", "-c", fmt.Sprintf("sh +x %s", util.HostPathToWSL(cf)))
+	res.StdoutTruncated = out.truncated
+	res.StderrTruncated = errOut.truncated
+
+	code, ok := wsl.ExitCode(err)
+	if !ok {
+		r.log.Warnf("Failed to execute command: %v", err)
+		res.Error = err.Error()
+		return res
+	}
+
+	res.ExitCode = code
+	res.Signal = exitSignal(code)
+	return res
+}
+
+// exitSignal returns the signal number if the exit code is reported by the shell for a command killed by a signal
+func exitSignal(code int) int {
+	if code > 128 && code < 128+32 {
+		return code - 128
+	}
+
+	return 0
+}
+
+// limitedWriter writes at most n bytes to w, the rest is discarded.
+//
+// It never returns an error for the discarded bytes, so the command will not be blocked or broken.
+type limitedWriter struct {
+	w         io.Writer
+	n         int
+	truncated bool
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if w.n <= 0 {
+		w.truncated = w.truncated || len(p) > 0
+		return len(p), nil
+	}
+
+	l := len(p)
+	if l > w.n {
+		p = p[:w.n]
+		w.truncated = true
+	}
+
+	n, err := w.w.Write(p)
+	w.n -= n
+	if err != nil {
+		return n, err
+	}
+
+	return l, nil
+}
+
+func limitWriter(w io.Writer, n int) *limitedWriter {
+	return &limitedWriter{
+		w: w,
+		n: n,
+	}
+}
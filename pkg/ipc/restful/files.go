@@ -0,0 +1,188 @@
+// SPDX-FileCopyrightText: 2025 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package restful
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/oomol-lab/ovm-win/pkg/wsl"
+)
+
+type fileProgress struct {
+	Bytes int64 `json:"bytes"`
+	// Total is the size of the request body, -1 if unknown
+	Total int64 `json:"total"`
+}
+
+type fileResult struct {
+	Path  string `json:"path"`
+	Bytes int64  `json:"bytes"`
+	Error string `json:"error,omitempty"`
+}
+
+// files handles `GET /files?path=` and `PUT /files?path=`
+func (r *routerRun) files(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		r.getFile(w, req)
+	case http.MethodPut:
+		r.putFile(w, req)
+	default:
+		r.log.Warnf("RESTful server: %s is not allowed in %s", req.Method, req.URL.Path)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// getFile streams the file content, or a tar archive if the path is a directory
+func (r *routerRun) getFile(w http.ResponseWriter, req *http.Request) {
+	p := req.URL.Query().Get("path")
+
+	info, err := wsl.StatFile(req.Context(), r.log, r.opt.DistroName, p)
+	if err != nil {
+		r.fileError(w, p, err)
+		return
+	}
+
+	if info.IsDir {
+		w.Header().Set("Content-Type", "application/x-tar")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", path.Base(p)+".tar"))
+	} else {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", path.Base(p)))
+		w.Header().Set("X-File-Size", strconv.FormatInt(info.Size, 10))
+	}
+	w.Header().Set("X-File-Mode", fmt.Sprintf("%04o", info.Mode.Perm()))
+
+	// the status code has been sent once the content is written, the client sees a truncated body on failure
+	if err := wsl.ReadFile(req.Context(), r.log, r.opt.DistroName, info, w); err != nil {
+		r.log.Warnf("Failed to read file %s: %v", p, err)
+	}
+}
+
+// putFile writes the request body to the path.
+//
+// Query:
+//   - path: the absolute path in the distro
+//   - mode: the octal permission of the file, default 0644
+//   - overwrite: `false` to refuse replacing the existing file (409), default true
+//   - tar: `true` to extract the body as a tar archive into the path
+//
+// If the client accepts `text/event-stream`, the `progress` events are sent during the transfer,
+// and the `done` event carries the result.
+func (r *routerRun) putFile(w http.ResponseWriter, req *http.Request) {
+	q := req.URL.Query()
+
+	opt := &wsl.WriteFileOpt{
+		Path:      q.Get("path"),
+		Overwrite: q.Get("overwrite") != "false",
+		Tar:       q.Get("tar") == "true",
+	}
+
+	if m := q.Get("mode"); m != "" {
+		mode, err := strconv.ParseUint(m, 8, 32)
+		if err != nil || mode > 0o777 {
+			http.Error(w, "invalid mode", http.StatusBadRequest)
+			return
+		}
+		opt.Mode = os.FileMode(mode)
+	}
+
+	body := &countingReader{r: req.Body}
+
+	if !strings.Contains(req.Header.Get("Accept"), "text/event-stream") {
+		if err := wsl.WriteFile(req.Context(), r.log, r.opt.DistroName, opt, body); err != nil {
+			r.fileError(w, opt.Path, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(&fileResult{
+			Path:  opt.Path,
+			Bytes: body.n.Load(),
+		})
+		return
+	}
+
+	// progress events are written while the body is still being read
+	if err := http.NewResponseController(w).EnableFullDuplex(); err != nil {
+		r.log.Warnf("Failed to enable full duplex: %v", err)
+	}
+
+	sse, ok := newSSE(w)
+	if !ok {
+		r.log.Warnf("Bowser does not support server-sent events")
+		return
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- wsl.WriteFile(req.Context(), r.log, r.opt.DistroName, opt, body)
+	}()
+
+	total := req.ContentLength
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case err := <-errCh:
+			res := &fileResult{
+				Path:  opt.Path,
+				Bytes: body.n.Load(),
+			}
+			if err != nil {
+				r.log.Warnf("Failed to write file %s: %v", opt.Path, err)
+				res.Error = err.Error()
+			}
+
+			data, _ := json.Marshal(res)
+			sse.Send("done", string(data))
+			return
+		case <-ticker.C:
+			data, _ := json.Marshal(&fileProgress{
+				Bytes: body.n.Load(),
+				Total: total,
+			})
+			sse.Send("progress", string(data))
+		}
+	}
+}
+
+func (r *routerRun) fileError(w http.ResponseWriter, p string, err error) {
+	r.log.Warnf("File operation on %s failed: %v", p, err)
+
+	switch {
+	case errors.Is(err, wsl.ErrFileNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, wsl.ErrFileExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, wsl.ErrGNUTarRequired):
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+	case !strings.HasPrefix(p, "/"):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+type countingReader struct {
+	r io.Reader
+	n atomic.Int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
@@ -8,7 +8,7 @@ import (
 	"fmt"
 	"net/http"
 
-	"github.com/oomol-lab/ovm-win/pkg/channel"
+	"github.com/oomol-lab/ovm-win/pkg/initstate"
 	"github.com/oomol-lab/ovm-win/pkg/logger"
 	"github.com/oomol-lab/ovm-win/pkg/types"
 	"github.com/oomol-lab/ovm-win/pkg/winapi/npipe"
@@ -19,8 +19,6 @@ import (
 type routerInit struct {
 	opt *types.InitOpt
 	log *logger.Context
-
-	canShutdownWSL bool
 }
 
 func SetupInit(opt *types.InitOpt) (s Server, err error) {
@@ -47,6 +45,8 @@ func (r *routerInit) Close() error {
 
 func (r *routerInit) mux() http.Handler {
 	mux := http.NewServeMux()
+	mux.Handle("/state", mustGet(r.log, middlewareLog(r.log, r.state)))
+	mux.Handle("/events", mustGet(r.log, middlewareLog(r.log, events(r.log))))
 	mux.Handle("/reboot", mustPost(r.log, middlewareLog(r.log, r.reboot)))
 	mux.Handle("/enable-feature", mustPost(r.log, middlewareLog(r.log, r.enableFeature)))
 	mux.Handle("/update-wsl", mustPut(r.log, middlewareLog(r.log, r.updateWSL)))
@@ -56,6 +56,10 @@ func (r *routerInit) mux() http.Handler {
 	return mux
 }
 
+func (r *routerInit) state(w http.ResponseWriter, req *http.Request) {
+	_ = json.NewEncoder(w).Encode(r.opt.State.Snapshot())
+}
+
 type rebootBody struct {
 	// RunOnce is the command to run after the next system startup
 	RunOnce string `json:"runOnce"`
@@ -64,8 +68,8 @@ type rebootBody struct {
 }
 
 func (r *routerInit) reboot(w http.ResponseWriter, req *http.Request) {
-	if !r.opt.CanReboot {
-		r.log.Warn("Reboot is not allowed")
+	if s := r.opt.State.Current(); s != initstate.NeedReboot {
+		r.log.Warnf("Reboot is not allowed in state %s", s)
 		http.Error(w, "reboot is not allowed", http.StatusForbidden)
 		return
 	}
@@ -97,8 +101,8 @@ func (r *routerInit) reboot(w http.ResponseWriter, req *http.Request) {
 }
 
 func (r *routerInit) enableFeature(w http.ResponseWriter, req *http.Request) {
-	if !r.opt.CanEnableFeature {
-		r.log.Warn("Enable feature is not allowed")
+	if err := r.opt.State.Swap(initstate.NeedEnableFeature, initstate.EnablingFeature); err != nil {
+		r.log.Warnf("Enable feature is not allowed: %v", err)
 		http.Error(w, "enable feature is not allowed", http.StatusForbidden)
 		return
 	}
@@ -111,8 +115,8 @@ func (r *routerInit) enableFeature(w http.ResponseWriter, req *http.Request) {
 }
 
 func (r *routerInit) updateWSL(w http.ResponseWriter, req *http.Request) {
-	if !r.opt.CanUpdateWSL {
-		r.log.Warn("Update WSL is not allowed")
+	if err := r.opt.State.Swap(initstate.NeedUpdateWSL, initstate.UpdatingWSL); err != nil {
+		r.log.Warnf("Update WSL is not allowed: %v", err)
 		http.Error(w, "update WSL is not allowed", http.StatusForbidden)
 		return
 	}
@@ -122,8 +126,6 @@ func (r *routerInit) updateWSL(w http.ResponseWriter, req *http.Request) {
 		http.Error(w, "failed to update WSL", http.StatusInternalServerError)
 		return
 	}
-
-	channel.NotifyWSLUpdated()
 }
 
 type fixWSLConfigBody struct {
@@ -131,12 +133,6 @@ type fixWSLConfigBody struct {
 }
 
 func (r *routerInit) fixWSLConfig(w http.ResponseWriter, req *http.Request) {
-	if !r.opt.CanFixWSLConfig {
-		r.log.Warn("Fix WSL config is not allowed")
-		http.Error(w, "fix WSL config is not allowed", http.StatusForbidden)
-		return
-	}
-
 	var body fixWSLConfigBody
 	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
 		r.log.Warnf("Failed to decode request body: %v", err)
@@ -144,6 +140,12 @@ func (r *routerInit) fixWSLConfig(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	if err := r.opt.State.Swap(initstate.WSLConfigIncompatible, initstate.FixingWSLConfig); err != nil {
+		r.log.Warnf("Fix WSL config is not allowed: %v", err)
+		http.Error(w, "fix WSL config is not allowed", http.StatusForbidden)
+		return
+	}
+
 	wslconfig := wsl.NewConfig(r.log)
 
 	r.log.Infof("Fix WSL config with method: %s", body.Method)
@@ -151,6 +153,7 @@ func (r *routerInit) fixWSLConfig(w http.ResponseWriter, req *http.Request) {
 	switch body.Method {
 	case "auto":
 		if err := wslconfig.Fix(); err != nil {
+			r.moveState(initstate.WSLConfigIncompatible)
 			r.log.Warnf("Failed to fix WSL config: %v", err)
 			http.Error(w, "failed to fix WSL config", http.StatusInternalServerError)
 			return
@@ -160,26 +163,37 @@ func (r *routerInit) fixWSLConfig(w http.ResponseWriter, req *http.Request) {
 			r.log.Warnf("Failed to shutdown WSL: %v", err)
 		}
 
-		channel.NotifyWSLConfigUpdated(wsl.FIX_WSLCONFIG_AUTO)
+		r.moveState(initstate.Passed)
 	case "open":
-		r.canShutdownWSL = true
-
 		if err := wslconfig.Open(); err != nil {
+			r.moveState(initstate.WSLConfigIncompatible)
 			r.log.Warnf("Failed to open WSL config: %v", err)
 			http.Error(w, "failed to open WSL config", http.StatusInternalServerError)
 			return
 		}
 
-		channel.NotifyWSLConfigUpdated(wsl.FIX_WSLCONFIG_OPEN)
+		// Wait for the user to edit the config, then call /shutdown-wsl
+		r.moveState(initstate.WaitingWSLShutdown)
 	case "skip":
 		wsl.SkipConfigCheck(r.opt)
-		channel.NotifyWSLConfigUpdated(wsl.FIX_WSLCONFIG_SKIP)
+		r.moveState(initstate.Passed)
+	default:
+		r.moveState(initstate.WSLConfigIncompatible)
+		http.Error(w, "unknown method", http.StatusBadRequest)
+	}
+}
+
+// moveState moves the init state after the fix has been claimed by Swap, so the transition is always legal,
+// the error is only logged in case the state table is changed
+func (r *routerInit) moveState(to initstate.State) {
+	if err := r.opt.State.To(to); err != nil {
+		r.log.Warnf("Failed to move init state: %v", err)
 	}
 }
 
 func (r *routerInit) shutdownWSL(w http.ResponseWriter, req *http.Request) {
-	if !r.canShutdownWSL {
-		r.log.Warn("Shutdown WSL is not allowed")
+	if s := r.opt.State.Current(); s != initstate.WaitingWSLShutdown {
+		r.log.Warnf("Shutdown WSL is not allowed in state %s", s)
 		http.Error(w, "shutdown WSL is not allowed", http.StatusForbidden)
 		return
 	}
@@ -190,6 +204,8 @@ func (r *routerInit) shutdownWSL(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	channel.NotifyWSLShutdown()
-	r.canShutdownWSL = false
+	if err := r.opt.State.Swap(initstate.WaitingWSLShutdown, initstate.Passed); err != nil {
+		r.log.Warnf("Failed to move init state: %v", err)
+		http.Error(w, "init state has changed", http.StatusConflict)
+	}
 }
@@ -0,0 +1,263 @@
+// SPDX-FileCopyrightText: 2025 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package restful
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oomol-lab/ovm-win/pkg/wsl"
+)
+
+// The interactive exec upgrades the connection (`Upgrade: ovm-exec`) and then exchanges frames in both directions.
+//
+// A frame is 1 byte type + 4 bytes big-endian payload length + payload.
+const upgradeInteractive = "ovm-exec"
+
+const (
+	// client -> server
+	frameStdin      byte = 0x00
+	frameResize     byte = 0x01 // {"rows": 24, "cols": 80}
+	frameSignal     byte = 0x02 // signal name, such as INT
+	frameCloseStdin byte = 0x03
+
+	// server -> client
+	frameStdout byte = 0x10
+	frameStderr byte = 0x11
+	frameExit   byte = 0x12 // {"exitCode": 0, "signal": 0, "error": ""}
+)
+
+const maxFrameSize = 1 << 20
+
+type interactiveBody struct {
+	Command string            `json:"command"`
+	Env     map[string]string `json:"env"`
+	Cwd     string            `json:"cwd"`
+	TTY     bool              `json:"tty"`
+	Rows    int               `json:"rows"`
+	Cols    int               `json:"cols"`
+}
+
+type resizeBody struct {
+	Rows int `json:"rows"`
+	Cols int `json:"cols"`
+}
+
+type exitBody struct {
+	ExitCode int `json:"exitCode"`
+	// Signal is the signal number that terminated the command, 0 if it exited normally
+	Signal int    `json:"signal,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+func (r *routerRun) execInteractive(w http.ResponseWriter, req *http.Request) {
+	if !strings.EqualFold(req.Header.Get("Upgrade"), upgradeInteractive) {
+		http.Error(w, "upgrade to "+upgradeInteractive+" required", http.StatusUpgradeRequired)
+		return
+	}
+
+	var body interactiveBody
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		r.log.Warnf("Failed to decode request body: %v", err)
+		http.Error(w, "failed to decode request body", http.StatusBadRequest)
+		return
+	}
+
+	if body.Command == "" {
+		body.Command = "sh -l"
+	}
+
+	// check before upgrading, so the client gets a plain HTTP error
+	if body.TTY {
+		if err := wsl.CheckTTY(r.log, r.opt.DistroName); err != nil {
+			http.Error(w, err.Error(), http.StatusNotImplemented)
+			return
+		}
+	}
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		r.log.Warnf("Connection does not support hijacking")
+		http.Error(w, "connection does not support hijacking", http.StatusInternalServerError)
+		return
+	}
+
+	conn, brw, err := hj.Hijack()
+	if err != nil {
+		r.log.Warnf("Failed to hijack connection: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	_, _ = fmt.Fprintf(brw, "HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: %s\r\n\r\n", upgradeInteractive)
+	if err := brw.Flush(); err != nil {
+		r.log.Warnf("Failed to write upgrade response: %v", err)
+		return
+	}
+
+	opt := &wsl.InteractiveOpt{
+		ID:      fmt.Sprintf("%d", time.Now().UnixNano()),
+		Command: body.Command,
+		Env:     body.Env,
+		Cwd:     body.Cwd,
+		TTY:     body.TTY,
+		Rows:    body.Rows,
+		Cols:    body.Cols,
+	}
+
+	// Use a pipe file as stdin, so that the child process reads it directly and exits with it being closed
+	stdinR, stdinW, err := os.Pipe()
+	if err != nil {
+		r.log.Warnf("Failed to create stdin pipe: %v", err)
+		return
+	}
+	defer stdinR.Close()
+	defer stdinW.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fw := &frameWriter{w: conn}
+	done := make(chan struct{})
+
+	go func() {
+		r.readInteractive(brw.Reader, opt.ID, stdinW)
+
+		select {
+		case <-done:
+			// pass
+		default:
+			r.log.Warnf("Client of interactive command %s closed connection", opt.ID)
+			if err := wsl.SignalInteractive(r.log, r.opt.DistroName, opt.ID, "HUP"); err != nil {
+				r.log.Warnf("Failed to hang up interactive command %s: %v", opt.ID, err)
+			}
+			cancel()
+		}
+	}()
+
+	code, err := wsl.Interactive(ctx, r.log, r.opt.DistroName, opt, stdinR, fw.stream(frameStdout), fw.stream(frameStderr))
+	close(done)
+
+	result := &exitBody{
+		ExitCode: code,
+	}
+	if err != nil {
+		r.log.Warnf("Failed to run interactive command: %v", err)
+		result.Error = err.Error()
+	} else {
+		result.Signal = exitSignal(code)
+	}
+
+	data, _ := json.Marshal(result)
+	if err := fw.writeFrame(frameExit, data); err != nil {
+		r.log.Warnf("Failed to send exit of interactive command %s: %v", opt.ID, err)
+	}
+}
+
+// readInteractive handles the frames from the client until the connection is closed
+func (r *routerRun) readInteractive(br *bufio.Reader, id string, stdin *os.File) {
+	for {
+		t, payload, err := readFrame(br)
+		if err != nil {
+			if err != io.EOF {
+				r.log.Warnf("Failed to read frame of interactive command %s: %v", id, err)
+			}
+			return
+		}
+
+		switch t {
+		case frameStdin:
+			if _, err := stdin.Write(payload); err != nil {
+				r.log.Warnf("Failed to write stdin of interactive command %s: %v", id, err)
+			}
+		case frameCloseStdin:
+			_ = stdin.Close()
+		case frameResize:
+			var size resizeBody
+			if err := json.Unmarshal(payload, &size); err != nil {
+				r.log.Warnf("Failed to decode resize frame: %v", err)
+				continue
+			}
+			if err := wsl.ResizeInteractive(r.log, r.opt.DistroName, id, size.Rows, size.Cols); err != nil {
+				r.log.Warnf("Failed to resize interactive command: %v", err)
+			}
+		case frameSignal:
+			if err := wsl.SignalInteractive(r.log, r.opt.DistroName, id, string(payload)); err != nil {
+				r.log.Warnf("Failed to signal interactive command: %v", err)
+			}
+		default:
+			r.log.Warnf("Unknown frame type %#x of interactive command %s", t, id)
+		}
+	}
+}
+
+func readFrame(r io.Reader) (byte, []byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > maxFrameSize {
+		return 0, nil, fmt.Errorf("frame size %d exceeds %d", size, maxFrameSize)
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+
+	return header[0], payload, nil
+}
+
+type frameWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (f *frameWriter) writeFrame(t byte, p []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var header [5]byte
+	header[0] = t
+	binary.BigEndian.PutUint32(header[1:], uint32(len(p)))
+
+	if _, err := f.w.Write(header[:]); err != nil {
+		return err
+	}
+	_, err := f.w.Write(p)
+	return err
+}
+
+func (f *frameWriter) stream(t byte) io.Writer {
+	return &frameStream{
+		f: f,
+		t: t,
+	}
+}
+
+type frameStream struct {
+	f *frameWriter
+	t byte
+}
+
+func (s *frameStream) Write(p []byte) (int, error) {
+	for i := 0; i < len(p); i += maxFrameSize {
+		if err := s.f.writeFrame(s.t, p[i:min(i+maxFrameSize, len(p))]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(p), nil
+}
@@ -0,0 +1,419 @@
+// SPDX-FileCopyrightText: 2025 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package restful
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxRunningJobs is the max number of exec jobs running at the same time
+	maxRunningJobs = 8
+	// maxFinishedJobs is the max number of finished exec jobs kept for listing and log replay
+	maxFinishedJobs = 32
+)
+
+var errTooManyJobs = fmt.Errorf("too many running jobs (max %d)", maxRunningJobs)
+
+type jobState string
+
+const (
+	jobRunning  jobState = "running"
+	jobExited   jobState = "exited"
+	jobCanceled jobState = "canceled"
+)
+
+// job is a command started by /exec, it is not tied to the request unless it is attached
+type job struct {
+	id        string
+	command   string
+	detached  bool
+	startedAt time.Time
+	cancel    context.CancelFunc
+	done      chan struct{}
+
+	mu         sync.Mutex
+	canceled   bool
+	finishedAt time.Time
+	logs       []execEvent
+	result     *execResult
+	subs       map[chan struct{}]struct{}
+}
+
+type jobInfo struct {
+	ID         string      `json:"id"`
+	Command    string      `json:"command"`
+	Detached   bool        `json:"detached"`
+	State      jobState    `json:"state"`
+	StartedAt  time.Time   `json:"startedAt"`
+	FinishedAt *time.Time  `json:"finishedAt,omitempty"`
+	Result     *execResult `json:"result,omitempty"`
+}
+
+func (j *job) info() *jobInfo {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	info := &jobInfo{
+		ID:        j.id,
+		Command:   j.command,
+		Detached:  j.detached,
+		State:     jobRunning,
+		StartedAt: j.startedAt,
+		Result:    j.result,
+	}
+
+	if j.result != nil {
+		info.State = jobExited
+		if j.canceled {
+			info.State = jobCanceled
+		}
+		t := j.finishedAt
+		info.FinishedAt = &t
+	}
+
+	return info
+}
+
+func (j *job) finished() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.result != nil
+}
+
+func (j *job) stop() {
+	j.mu.Lock()
+	if j.result == nil {
+		j.canceled = true
+	}
+	j.mu.Unlock()
+
+	j.cancel()
+}
+
+func (j *job) append(name string, p []byte) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.logs = append(j.logs, execEvent{name: name, data: string(p)})
+	j.notify()
+}
+
+func (j *job) finish(res *execResult) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.result = res
+	j.finishedAt = time.Now()
+	j.notify()
+	close(j.done)
+}
+
+// notify wakes up the followers, the caller must hold the lock
+func (j *job) notify() {
+	for ch := range j.subs {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// subscribe returns a channel which is signaled when the job has new logs or finished
+func (j *job) subscribe() (<-chan struct{}, func()) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	ch := make(chan struct{}, 1)
+	j.subs[ch] = struct{}{}
+
+	return ch, func() {
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		delete(j.subs, ch)
+	}
+}
+
+// since returns the logs after the index from, and the result if the job is finished
+func (j *job) since(from int) ([]execEvent, *execResult) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if from > len(j.logs) {
+		from = len(j.logs)
+	}
+
+	return j.logs[from:], j.result
+}
+
+// output returns the whole output of the stream
+func (j *job) output(name string) string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var sb strings.Builder
+	for _, ev := range j.logs {
+		if ev.name == name {
+			sb.WriteString(ev.data)
+		}
+	}
+
+	return sb.String()
+}
+
+func (j *job) writer(name string) *jobWriter {
+	return &jobWriter{
+		j:    j,
+		name: name,
+	}
+}
+
+type jobWriter struct {
+	j    *job
+	name string
+}
+
+func (w *jobWriter) Write(p []byte) (int, error) {
+	w.j.append(w.name, p)
+	return len(p), nil
+}
+
+type jobManager struct {
+	mu   sync.Mutex
+	seq  uint64
+	jobs map[string]*job
+}
+
+func newJobManager() *jobManager {
+	return &jobManager{
+		jobs: make(map[string]*job),
+	}
+}
+
+// start runs the command in a new job
+func (m *jobManager) start(r *routerRun, body *execBody) (*job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	running := 0
+	for _, j := range m.jobs {
+		if !j.finished() {
+			running++
+		}
+	}
+	if running >= maxRunningJobs {
+		return nil, errTooManyJobs
+	}
+
+	m.seq++
+	ctx, cancel := context.WithCancel(context.Background())
+	j := &job{
+		id:        strconv.FormatUint(m.seq, 10),
+		command:   body.Command,
+		detached:  body.Detached,
+		startedAt: time.Now(),
+		cancel:    cancel,
+		done:      make(chan struct{}),
+		subs:      make(map[chan struct{}]struct{}),
+	}
+	m.jobs[j.id] = j
+	m.prune()
+
+	r.log.Infof("Exec job %s started", j.id)
+
+	go func() {
+		defer cancel()
+		j.finish(runExec(ctx, r, body, j.writer("stdout"), j.writer("stderr")))
+		r.log.Infof("Exec job %s finished", j.id)
+	}()
+
+	return j, nil
+}
+
+// prune removes the oldest finished jobs beyond maxFinishedJobs, the caller must hold the lock
+func (m *jobManager) prune() {
+	var finished []*job
+	for _, j := range m.jobs {
+		if j.finished() {
+			finished = append(finished, j)
+		}
+	}
+
+	if len(finished) <= maxFinishedJobs {
+		return
+	}
+
+	sort.Slice(finished, func(i, k int) bool {
+		return finished[i].startedAt.Before(finished[k].startedAt)
+	})
+
+	for _, j := range finished[:len(finished)-maxFinishedJobs] {
+		delete(m.jobs, j.id)
+	}
+}
+
+func (m *jobManager) get(id string) (*job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	j, ok := m.jobs[id]
+	return j, ok
+}
+
+func (m *jobManager) remove(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.jobs, id)
+}
+
+func (m *jobManager) list() []*jobInfo {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	list := make([]*jobInfo, 0, len(m.jobs))
+	for _, j := range m.jobs {
+		list = append(list, j.info())
+	}
+
+	sort.Slice(list, func(i, k int) bool {
+		return list[i].StartedAt.Before(list[k].StartedAt)
+	})
+
+	return list
+}
+
+// stopAll cancels all running jobs
+func (m *jobManager) stopAll() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, j := range m.jobs {
+		j.stop()
+	}
+}
+
+// follow streams the logs of the job after the index from, until the job is finished or the client closed connection.
+//
+// It returns false if the client closed connection.
+func follow(ctx context.Context, sse *sseWriter, j *job, from int) bool {
+	notify, unsubscribe := j.subscribe()
+	defer unsubscribe()
+
+	for {
+		logs, res := j.since(from)
+		for _, ev := range logs {
+			from++
+			sse.SendWithID(strconv.Itoa(from), ev.name, ev.data)
+		}
+
+		if res != nil {
+			data, _ := json.Marshal(res)
+			sse.Send("done", string(data))
+			return true
+		}
+
+		select {
+		case <-notify:
+		case <-ctx.Done():
+			return false
+		case <-time.After(3 * time.Second):
+			sse.Ping()
+		}
+	}
+}
+
+func (r *routerRun) listJobs(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(r.jobs.list())
+}
+
+// job handles `/exec/jobs/{id}` (GET, DELETE) and `/exec/jobs/{id}/logs` (GET)
+func (r *routerRun) job(w http.ResponseWriter, req *http.Request) {
+	id, sub, _ := strings.Cut(strings.TrimPrefix(req.URL.Path, "/exec/jobs/"), "/")
+
+	j, ok := r.jobs.get(id)
+	if !ok {
+		http.Error(w, "job not found", http.StatusNotFound)
+		return
+	}
+
+	switch {
+	case sub == "" && req.Method == http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(j.info())
+	case sub == "" && req.Method == http.MethodDelete:
+		r.deleteJob(w, j)
+	case sub == "logs" && req.Method == http.MethodGet:
+		r.jobLogs(w, req, j)
+	case sub == "" || sub == "logs":
+		r.log.Warnf("RESTful server: %s is not allowed in %s", req.Method, req.URL.Path)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+// deleteJob cancels the running job, or removes the finished job from the registry
+func (r *routerRun) deleteJob(w http.ResponseWriter, j *job) {
+	if j.finished() {
+		r.jobs.remove(j.id)
+	} else {
+		r.log.Infof("Cancel exec job %s", j.id)
+		j.stop()
+
+		select {
+		case <-j.done:
+		case <-time.After(5 * time.Second):
+			r.log.Warnf("Exec job %s is not finished after being canceled", j.id)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(j.info())
+}
+
+// jobLogs replays the logs of the job, and follows the new logs with `?follow=true`.
+//
+// The client can resume from the last received event with the Last-Event-ID header.
+func (r *routerRun) jobLogs(w http.ResponseWriter, req *http.Request, j *job) {
+	from := 0
+	if last := req.Header.Get("Last-Event-ID"); last != "" {
+		n, err := strconv.Atoi(last)
+		if err != nil || n < 0 {
+			http.Error(w, "invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+		from = n
+	}
+
+	sse, ok := newSSE(w)
+	if !ok {
+		r.log.Warnf("Bowser does not support server-sent events")
+		return
+	}
+
+	if req.URL.Query().Get("follow") == "true" {
+		_ = follow(req.Context(), sse, j, from)
+		return
+	}
+
+	logs, res := j.since(from)
+	for i, ev := range logs {
+		sse.SendWithID(strconv.Itoa(from+i+1), ev.name, ev.data)
+	}
+	if res != nil {
+		data, _ := json.Marshal(res)
+		sse.Send("done", string(data))
+	}
+}
@@ -0,0 +1,132 @@
+// SPDX-FileCopyrightText: 2025 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package restful
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/oomol-lab/ovm-win/pkg/logger"
+	"github.com/oomol-lab/ovm-win/pkg/wsl"
+)
+
+// logsFollowBuffer is the number of lines buffered for a following client, the client is dropped when it is full
+const logsFollowBuffer = 1024
+
+// logs sends the lines of the current log file as `log` events.
+//
+// Query:
+//   - source: `main` (default) for the log of this process, `vm` for the output of ovmd
+//   - follow: `true` to keep sending the new lines until the client disconnects
+//   - since: only send the lines after the time, RFC 3339 (2025-01-02T15:04:05+08:00) or a duration (10m)
+//
+// Once the client is too slow to keep up, an `error` event is sent and the stream is closed.
+func (r *routerRun) logs(w http.ResponseWriter, req *http.Request) {
+	q := req.URL.Query()
+
+	var log *logger.Context
+	switch q.Get("source") {
+	case "", "main":
+		log = r.log
+	case "vm":
+		log = wsl.VMLog()
+		if log == nil {
+			http.Error(w, "ovmd has not been launched", http.StatusServiceUnavailable)
+			return
+		}
+	default:
+		http.Error(w, "source must be main or vm", http.StatusBadRequest)
+		return
+	}
+
+	var since time.Time
+	if s := q.Get("since"); s != "" {
+		if t, err := time.Parse(time.RFC3339, s); err == nil {
+			since = t
+		} else if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+			since = time.Now().Add(-d)
+		} else {
+			http.Error(w, "since must be an RFC 3339 time or a duration", http.StatusBadRequest)
+			return
+		}
+	}
+
+	f, err := log.Follow(logsFollowBuffer)
+	if err != nil {
+		r.log.Warnf("Failed to follow log: %v", err)
+		http.Error(w, "failed to read log", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	if q.Get("follow") != "true" {
+		f.Close()
+	}
+
+	sse, ok := newSSE(w)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	// the lines without time (e.g. a multi-line message) follow the decision of the previous line
+	include := since.IsZero()
+	for _, line := range bytes.SplitAfter(f.History, []byte("\n")) {
+		if t, ok := logger.LineTime(line); ok {
+			include = !t.Before(since)
+		}
+		if include && len(bytes.TrimSpace(line)) != 0 {
+			sse.Send("log", logLine(line))
+		}
+	}
+
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case line, ok := <-f.C:
+			if !ok {
+				if f.Lagged() {
+					sse.Send("error", "too slow to keep up with the log")
+				}
+				return
+			}
+			sse.Send("log", logLine(line))
+		case <-time.After(3 * time.Second):
+			sse.Ping()
+		}
+	}
+}
+
+// logLine removes the line break, every `log` event is a line
+func logLine(line []byte) string {
+	return string(bytes.TrimRight(line, "\r\n"))
+}
+
+type logLevelBody struct {
+	Level string `json:"level"`
+}
+
+// logLevel changes the minimum level of the log at runtime, e.g. `{"level": "debug"}`, the new level is responded
+func (r *routerRun) logLevel(w http.ResponseWriter, req *http.Request) {
+	var body logLevelBody
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		r.log.Warnf("Failed to decode request body: %v", err)
+		http.Error(w, "failed to decode request body", http.StatusBadRequest)
+		return
+	}
+
+	l, err := logger.ParseLevel(body.Level)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	r.log.Infof("Change log level from %s to %s", logger.CurrentLevel(), l)
+	logger.SetLevel(l)
+
+	_ = json.NewEncoder(w).Encode(logLevelBody{Level: l.String()})
+}
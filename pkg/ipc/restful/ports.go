@@ -0,0 +1,74 @@
+// SPDX-FileCopyrightText: 2025 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package restful
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/oomol-lab/ovm-win/pkg/portforward"
+)
+
+// ports handles `GET /ports`, `POST /ports` and `DELETE /ports/{hostPort}`
+func (r *routerRun) ports(w http.ResponseWriter, req *http.Request) {
+	p := strings.Trim(strings.TrimPrefix(req.URL.Path, "/ports"), "/")
+
+	switch {
+	case p == "" && req.Method == http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(r.opt.Ports.List())
+	case p == "" && req.Method == http.MethodPost:
+		r.addPort(w, req)
+	case p != "" && req.Method == http.MethodDelete:
+		r.removePort(w, p)
+	default:
+		r.log.Warnf("RESTful server: %s is not allowed in %s", req.Method, req.URL.Path)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (r *routerRun) addPort(w http.ResponseWriter, req *http.Request) {
+	var body portforward.Mapping
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		r.log.Warnf("Failed to decode request body: %v", err)
+		http.Error(w, "failed to decode request body", http.StatusBadRequest)
+		return
+	}
+
+	s, err := r.opt.Ports.Add(body)
+	if err != nil {
+		r.log.Warnf("Failed to forward port %+v: %v", body, err)
+
+		switch {
+		case errors.Is(err, portforward.ErrConflict), errors.Is(err, portforward.ErrReserved), errors.Is(err, portforward.ErrOccupied):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(s)
+}
+
+func (r *routerRun) removePort(w http.ResponseWriter, p string) {
+	port, err := strconv.Atoi(p)
+	if err != nil {
+		http.Error(w, "invalid host port", http.StatusBadRequest)
+		return
+	}
+
+	if err := r.opt.Ports.Remove(port); err != nil {
+		r.log.Warnf("Failed to remove port forward %d: %v", port, err)
+		if errors.Is(err, portforward.ErrNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"sync/atomic"
 
 	"github.com/oomol-lab/ovm-win/pkg/logger"
 )
@@ -49,11 +50,14 @@ func (s *server) Close() error {
 	return nil
 }
 
+var requestID atomic.Uint64
+
 func middlewareLog(log *logger.Context, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, req *http.Request) {
-		log.Infof("RESTful server: received request: %s", req.URL.Path)
+		l := log.With("request", requestID.Add(1))
+		l.Infof("RESTful server: received request: %s", req.URL.Path)
 		next.ServeHTTP(w, req)
-		log.Infof("RESTful server: finished request: %s", req.URL.Path)
+		l.Infof("RESTful server: finished request: %s", req.URL.Path)
 	}
 }
 
@@ -4,28 +4,27 @@
 package restful
 
 import (
-	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
-	"os"
 	"path/filepath"
+	"slices"
 	"strings"
-	"sync"
 	"time"
 
-	"github.com/Code-Hex/go-infinity-channel"
 	"github.com/oomol-lab/ovm-win/pkg/logger"
+	"github.com/oomol-lab/ovm-win/pkg/podman"
 	"github.com/oomol-lab/ovm-win/pkg/types"
-	"github.com/oomol-lab/ovm-win/pkg/util"
+	"github.com/oomol-lab/ovm-win/pkg/update"
 	"github.com/oomol-lab/ovm-win/pkg/winapi/npipe"
 	"github.com/oomol-lab/ovm-win/pkg/wsl"
 )
 
 type routerRun struct {
-	opt *types.RunOpt
-	log *logger.Context
+	opt  *types.RunOpt
+	log  *logger.Context
+	jobs *jobManager
 
 	needWaitClose bool
 	waitClose     chan struct{}
@@ -35,6 +34,7 @@ func SetupRun(opt *types.RunOpt) (s Server, err error) {
 	rp := &routerRun{
 		opt:       opt,
 		log:       opt.Logger,
+		jobs:      newJobManager(),
 		waitClose: make(chan struct{}, 1),
 	}
 
@@ -60,6 +60,7 @@ func (r *routerRun) Close() error {
 	}
 
 	close(r.waitClose)
+	r.jobs.stopAll()
 
 	return nil
 }
@@ -67,17 +68,33 @@ func (r *routerRun) Close() error {
 func (r *routerRun) mux() http.Handler {
 	mux := http.NewServeMux()
 	mux.Handle("/info", mustGet(r.log, middlewareLog(r.log, r.info)))
+	mux.Handle("/status", mustGet(r.log, middlewareLog(r.log, r.status)))
+	mux.Handle("/events", mustGet(r.log, middlewareLog(r.log, events(r.log))))
 	mux.Handle("/request-stop", mustPost(r.log, middlewareLog(r.log, r.needWait(r.requestStop))))
 	mux.Handle("/stop", mustPost(r.log, middlewareLog(r.log, r.needWait(r.stop))))
 	mux.Handle("/exec", mustPost(r.log, middlewareLog(r.log, r.exec)))
+	mux.Handle("/exec/jobs", mustGet(r.log, middlewareLog(r.log, r.listJobs)))
+	mux.Handle("/exec/jobs/", middlewareLog(r.log, r.job))
+	mux.Handle("/exec/interactive", mustPost(r.log, middlewareLog(r.log, r.execInteractive)))
+	mux.Handle("/files", middlewareLog(r.log, r.files))
+	mux.Handle("/ports", middlewareLog(r.log, r.ports))
+	mux.Handle("/ports/", middlewareLog(r.log, r.ports))
+	mux.Handle("/logs", mustGet(r.log, middlewareLog(r.log, r.logs)))
+	mux.Handle("/log-level", mustPut(r.log, middlewareLog(r.log, r.logLevel)))
+	mux.Handle("/diagnostics", mustPost(r.log, middlewareLog(r.log, r.diagnostics)))
 
 	return mux
 }
 
 type infoResponse struct {
-	PodmanHost   string `json:"podmanHost"`
-	PodmanPort   int    `json:"podmanPort"`
-	HostEndpoint string `json:"hostEndpoint"`
+	// PodmanHost and PodmanPort are omitted if the TCP listener is disabled (--podman-tcp=false)
+	PodmanHost string `json:"podmanHost,omitempty"`
+	PodmanPort int    `json:"podmanPort,omitempty"`
+	// PodmanSocket is the named pipe of the podman API, such as npipe:////./pipe/ovm-foo-podman
+	PodmanSocket string `json:"podmanSocket,omitempty"`
+	// PodmanVersion is the podman version reported when podman became ready
+	PodmanVersion string `json:"podmanVersion,omitempty"`
+	HostEndpoint  string `json:"hostEndpoint"`
 }
 
 func (r *routerRun) info(w http.ResponseWriter, req *http.Request) {
@@ -88,186 +105,143 @@ func (r *routerRun) info(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	_ = json.NewEncoder(w).Encode(&infoResponse{
-		PodmanHost:   "127.0.0.1",
-		PodmanPort:   r.opt.PodmanPort,
+	resp := &infoResponse{
 		HostEndpoint: he,
-	})
-}
+	}
 
-func (r *routerRun) requestStop(w http.ResponseWriter, req *http.Request) {
-	if err := wsl.RequestStop(r.log, r.opt.DistroName); err != nil {
-		r.log.Warnf("Failed to request stop: %v", err)
-		http.Error(w, "failed to request stop", http.StatusInternalServerError)
-		return
+	if r.opt.PodmanTCP {
+		resp.PodmanHost = "127.0.0.1"
+		resp.PodmanPort = r.opt.PodmanPort
 	}
 
-	r.opt.StoppedWithAPI = true
-}
+	if v := podman.LastVersion(); v != nil {
+		resp.PodmanVersion = v.Version
+	}
 
-func (r *routerRun) stop(w http.ResponseWriter, req *http.Request) {
-	if err := wsl.Stop(r.log, r.opt.DistroName); err != nil {
-		r.log.Warnf("Failed to stop: %v", err)
-		http.Error(w, "failed to stop", http.StatusInternalServerError)
-		return
+	if r.opt.PodmanNpipe {
+		resp.PodmanSocket = "npipe://" + strings.ReplaceAll(r.opt.PodmanNpipePath, `\`, "/")
 	}
 
-	r.opt.StoppedWithAPI = true
+	_ = json.NewEncoder(w).Encode(resp)
 }
 
-type execBody struct {
-	Command string `json:"command"`
+type distroStatus struct {
+	Name       string `json:"name"`
+	Registered bool   `json:"registered"`
+	Running    bool   `json:"running"`
+	Error      string `json:"error,omitempty"`
 }
 
-func (r *routerRun) exec(w http.ResponseWriter, req *http.Request) {
-	var body execBody
-	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
-		r.log.Warnf("Failed to decode request body: %v", err)
-		http.Error(w, "failed to decode request body", http.StatusBadRequest)
-		return
-	}
-
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
+type podmanStatus struct {
+	Ready     bool   `json:"ready"`
+	Reachable bool   `json:"reachable"`
+	Version   string `json:"version,omitempty"`
+	Error     string `json:"error,omitempty"`
+	// Attempts are the latest probe attempts, including the ones while waiting for podman to be ready
+	Attempts []podman.Attempt `json:"attempts"`
+}
 
-	if _, ok := w.(http.Flusher); !ok {
-		r.log.Warnf("Bowser does not support server-sent events")
-		return
-	}
+type diskStatus struct {
+	Path     string `json:"path"`
+	Attached bool   `json:"attached"`
+}
 
-	outCh := infinity.NewChannel[string]()
-	errCh := make(chan string, 1)
-	doneCh := make(chan struct{}, 1)
+type ovmdStatus struct {
+	wsl.OVMDStatus
+	// Uptime is the seconds since ovmd started, 0 if not running
+	Uptime int64 `json:"uptime"`
+}
 
-	go func() {
-		if err := exec(req.Context(), r, body.Command, outCh, errCh); err != nil {
-			r.log.Warnf("Failed to execute command: %v", err)
-		}
+type statusResponse struct {
+	Distro   distroStatus     `json:"distro"`
+	Podman   podmanStatus     `json:"podman"`
+	Disks    []diskStatus     `json:"disks"`
+	OVMD     ovmdStatus       `json:"ovmd"`
+	Versions *update.Manifest `json:"versions"`
+}
 
-		doneCh <- struct{}{}
-		outCh.Close()
-		close(errCh)
-	}()
+func (r *routerRun) status(w http.ResponseWriter, req *http.Request) {
+	resp := &statusResponse{
+		Distro: distroStatus{
+			Name: r.opt.DistroName,
+		},
+	}
 
-	defer func() {
-		select {
-		case <-req.Context().Done():
-			// pass
-		default:
-			_, _ = fmt.Fprintf(w, "event: done\n")
-			_, _ = fmt.Fprintf(w, "data: done\n\n")
-			w.(http.Flusher).Flush()
-		}
-	}()
+	if ok, err := wsl.IsRegister(r.log, r.opt.DistroName); err != nil {
+		resp.Distro.Error = err.Error()
+	} else {
+		resp.Distro.Registered = ok
+	}
 
-	for {
-		select {
-		case <-doneCh:
-			r.log.Warnf("Command execution finished")
-			return
-		case err, ok := <-errCh:
-			if !ok {
-				return
-			}
-			_, _ = fmt.Fprintf(w, "event: error\n")
-			_, _ = fmt.Fprintf(w, "data: %s\n\n", encodeSSE(err))
-			w.(http.Flusher).Flush()
-			continue
-		case out := <-outCh.Out():
-			_, _ = fmt.Fprintf(w, "event: out\n")
-			_, _ = fmt.Fprintf(w, "data: %s\n\n", encodeSSE(out))
-			w.(http.Flusher).Flush()
-			continue
-		case <-req.Context().Done():
-			r.log.Warnf("Client closed connection")
-			return
-		case <-time.After(3 * time.Second):
-			_, _ = fmt.Fprintf(w, ": ping\n\n")
-			w.(http.Flusher).Flush()
-			continue
+	if resp.Distro.Registered {
+		if ok, err := wsl.IsRunning(r.log, r.opt.DistroName); err != nil {
+			resp.Distro.Error = err.Error()
+		} else {
+			resp.Distro.Running = ok
 		}
 	}
-}
-
-func (r *routerRun) needWait(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, req *http.Request) {
-		r.needWaitClose = true
 
-		next.ServeHTTP(w, req)
-
-		r.waitClose <- struct{}{}
-		r.needWaitClose = false
-		r.waitClose = make(chan struct{})
+	if v, err := podman.Check(req.Context(), wsl.PodmanDialer(r.opt)); err != nil {
+		resp.Podman.Error = err.Error()
+		resp.Podman.Reachable = !errors.Is(err, podman.ErrUnreachable)
+	} else {
+		resp.Podman.Ready = true
+		resp.Podman.Reachable = true
+		resp.Podman.Version = v.Version
+	}
+	resp.Podman.Attempts = podman.Attempts()
+
+	attached := wsl.AttachedDisks()
+	for _, name := range []string{"data.vhdx", "sourcecode.vhdx"} {
+		p := filepath.Join(r.opt.ImageDir, name)
+		resp.Disks = append(resp.Disks, diskStatus{
+			Path:     p,
+			Attached: slices.ContainsFunc(attached, func(a string) bool { return strings.EqualFold(a, p) }),
+		})
 	}
-}
 
-func exec(ctx context.Context, r *routerRun, command string, outCh *infinity.Channel[string], errCh chan string) error {
-	cf := filepath.Join(os.TempDir(), fmt.Sprintf("ovm-exec-%d.sh", time.Now().UnixNano()))
-	if err := os.WriteFile(cf, []byte(command), 0o644); err != nil {
-		return fmt.Errorf("failed to write command to file: %w", err)
+	resp.OVMD.OVMDStatus = wsl.OVMD()
+	if resp.OVMD.Running {
+		resp.OVMD.Uptime = int64(time.Since(resp.OVMD.StartedAt).Seconds())
 	}
-	defer func() {
-		_ = os.Remove(cf)
-	}()
-
-	cfWSL := util.HostPathToWSL(cf)
-	arg := []string{"-d", r.opt.DistroName, "sh", "-c", fmt.Sprintf("sh +x %s", cfWSL)}
-	cmd := util.SilentCmdContext(ctx, wsl.Find(), arg...)
-
-	cmd.Env = []string{"WSL_UTF8=1"}
-	out := ch2Writer(outCh)
-	cmd.Stdout = out
-	stderr := recordWriter(out)
-	cmd.Stderr = stderr
-
-	if err := cmd.Run(); err != nil {
-		newErr := fmt.Errorf("%s\n%s", stderr.LastRecord(), err)
-		errCh <- fmt.Sprintf(newErr.Error())
-		return fmt.Errorf("run exec command error: %w", newErr)
+
+	if v, _, err := update.ReadManifest(r.opt.ImageDir); err != nil {
+		r.log.Warnf("Failed to read versions: %v", err)
+	} else {
+		resp.Versions = v
 	}
 
-	return nil
+	_ = json.NewEncoder(w).Encode(resp)
 }
 
-type chWriter struct {
-	ch *infinity.Channel[string]
-	mu sync.Mutex
-}
+func (r *routerRun) requestStop(w http.ResponseWriter, req *http.Request) {
+	if err := wsl.RequestStop(r.log, r.opt.DistroName); err != nil {
+		r.log.Warnf("Failed to request stop: %v", err)
+		http.Error(w, "failed to request stop", http.StatusInternalServerError)
+		return
+	}
 
-func (w *chWriter) Write(p []byte) (n int, err error) {
-	w.mu.Lock()
-	defer w.mu.Unlock()
-	w.ch.In() <- string(p)
-	return len(p), nil
+	r.opt.StoppedWithAPI = true
 }
 
-func ch2Writer(ch *infinity.Channel[string]) io.Writer {
-	return &chWriter{
-		ch: ch,
+func (r *routerRun) stop(w http.ResponseWriter, req *http.Request) {
+	if err := wsl.Stop(r.log, r.opt.DistroName); err != nil {
+		r.log.Warnf("Failed to stop: %v", err)
+		http.Error(w, "failed to stop", http.StatusInternalServerError)
+		return
 	}
-}
 
-type writer struct {
-	w    io.Writer
-	last []byte
+	r.opt.StoppedWithAPI = true
 }
 
-func (w *writer) Write(p []byte) (n int, err error) {
-	w.last = p
-	return w.w.Write(p)
-}
+func (r *routerRun) needWait(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		r.needWaitClose = true
 
-func (w *writer) LastRecord() string {
-	return string(w.last)
-}
+		next.ServeHTTP(w, req)
 
-func recordWriter(w io.Writer) *writer {
-	return &writer{
-		w: w,
+		r.waitClose <- struct{}{}
+		r.needWaitClose = false
+		r.waitClose = make(chan struct{})
 	}
 }
-
-func encodeSSE(str string) string {
-	return strings.ReplaceAll(strings.TrimSpace(str), "\n", "\ndata: ")
-}
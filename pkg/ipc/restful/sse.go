@@ -0,0 +1,57 @@
+// SPDX-FileCopyrightText: 2025 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package restful
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+type sseWriter struct {
+	w http.ResponseWriter
+	f http.Flusher
+}
+
+func newSSE(w http.ResponseWriter) (*sseWriter, bool) {
+	f, ok := w.(http.Flusher)
+	if !ok {
+		return nil, false
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	return &sseWriter{
+		w: w,
+		f: f,
+	}, true
+}
+
+func (s *sseWriter) Send(event, data string) {
+	_, _ = fmt.Fprintf(s.w, "event: %s\n", event)
+	_, _ = fmt.Fprintf(s.w, "data: %s\n\n", encodeSSE(data))
+	s.f.Flush()
+}
+
+// SendWithID sends the event with id, the client can resume from it with the Last-Event-ID header
+func (s *sseWriter) SendWithID(id, event, data string) {
+	_, _ = fmt.Fprintf(s.w, "id: %s\n", id)
+	s.Send(event, data)
+}
+
+func (s *sseWriter) Ping() {
+	_, _ = fmt.Fprintf(s.w, ": ping\n\n")
+	s.f.Flush()
+}
+
+// sseLineBreaks are the line terminators of SSE, a `\r` would end the data line as well
+var sseLineBreaks = strings.NewReplacer("\r\n", "\ndata: ", "\r", "\ndata: ", "\n", "\ndata: ")
+
+// encodeSSE keeps the data as is (leading spaces, blank lines), every line becomes a `data:` line,
+// and the client joins them with `\n`
+func encodeSSE(str string) string {
+	return sseLineBreaks.Replace(str)
+}
@@ -0,0 +1,119 @@
+// SPDX-FileCopyrightText: 2025 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Follower receives the lines written to a logger, see [Context.Follow]
+type Follower struct {
+	// History is the content of the current file before following
+	History []byte
+	// C receives the lines written after History, it is closed by [Follower.Close],
+	// or if the receiver is too slow to keep up (Lagged returns true)
+	C <-chan []byte
+
+	w      *syncWriter
+	ch     chan []byte
+	lagged bool
+}
+
+// Follow reads the current file and subscribes to the following writes.
+//
+// The file is read while holding the write lock, so no line is lost or duplicated even if the file is being rotated.
+// Only the lines written by this process are delivered, the lines of child processes (see [NewWithChildProcess]) are not.
+func (c *Context) Follow(buffer int) (*Follower, error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	history, err := os.ReadFile(c.file.Name())
+	if err != nil {
+		return nil, fmt.Errorf("cannot read log file: %v", err)
+	}
+
+	f := &Follower{
+		History: history,
+		w:       c.syncWriter,
+		ch:      make(chan []byte, buffer),
+	}
+	f.C = f.ch
+	c.followers = append(c.followers, f)
+
+	return f, nil
+}
+
+// Close stops following, it is safe to call more than once
+func (f *Follower) Close() {
+	f.w.m.Lock()
+	defer f.w.m.Unlock()
+
+	f.w.removeFollower(f)
+}
+
+// Lagged reports whether C is closed because the receiver is too slow
+func (f *Follower) Lagged() bool {
+	f.w.m.Lock()
+	defer f.w.m.Unlock()
+
+	return f.lagged
+}
+
+// publish delivers the line to the followers, the caller must hold the lock
+func (w *syncWriter) publish(b []byte) {
+	if len(w.followers) == 0 {
+		return
+	}
+
+	line := bytes.Clone(b)
+	for _, f := range w.followers {
+		select {
+		case f.ch <- line:
+		default:
+			// never block the writer, drop the follower instead
+			f.lagged = true
+			w.removeFollower(f)
+		}
+	}
+}
+
+// removeFollower closes and removes the follower, the caller must hold the lock
+func (w *syncWriter) removeFollower(f *Follower) {
+	for i, ff := range w.followers {
+		if ff == f {
+			close(f.ch)
+			w.followers = append(w.followers[:i:i], w.followers[i+1:]...)
+			return
+		}
+	}
+}
+
+// LineTime returns the time of the log line in both text and JSON format
+func LineTime(line []byte) (time.Time, bool) {
+	line = bytes.TrimSpace(line)
+
+	if bytes.HasPrefix(line, []byte("{")) {
+		var v struct {
+			Time time.Time `json:"time"`
+		}
+		if err := json.Unmarshal(line, &v); err != nil || v.Time.IsZero() {
+			return time.Time{}, false
+		}
+		return v.Time, true
+	}
+
+	if len(line) < len(textTimeLayout) {
+		return time.Time{}, false
+	}
+
+	t, err := time.ParseInLocation(textTimeLayout, string(line[:len(textTimeLayout)]), time.Local)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
@@ -0,0 +1,186 @@
+// SPDX-FileCopyrightText: 2025 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+type Level int32
+
+const (
+	LevelTrace Level = iota - 2
+	LevelDebug
+	LevelInfo
+	LevelWarn
+	LevelError
+
+	// levelRaw is the level of the raw lines (such as the output of ovmd), they are never filtered
+	levelRaw Level = 100
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelTrace:
+		return "trace"
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	default:
+		return ""
+	}
+}
+
+// ParseLevel parses the level name, such as debug or INFO
+func ParseLevel(s string) (Level, error) {
+	for _, l := range []Level{LevelTrace, LevelDebug, LevelInfo, LevelWarn, LevelError} {
+		if strings.EqualFold(s, l.String()) {
+			return l, nil
+		}
+	}
+
+	return LevelInfo, fmt.Errorf("unknown log level: %q", s)
+}
+
+type Format int32
+
+const (
+	// FormatText is the `date [TAG]: message key=value` line
+	FormatText Format = iota
+	// FormatJSON is one JSON object per line
+	FormatJSON
+)
+
+// ParseFormat parses the format name, text or json
+func ParseFormat(s string) (Format, error) {
+	switch strings.ToLower(s) {
+	case "text":
+		return FormatText, nil
+	case "json":
+		return FormatJSON, nil
+	default:
+		return FormatText, fmt.Errorf("unknown log format: %q", s)
+	}
+}
+
+var (
+	level  atomic.Int32
+	format atomic.Int32
+)
+
+func init() {
+	level.Store(int32(LevelInfo))
+}
+
+// SetLevel sets the minimum level of all loggers, it can be changed at runtime
+func SetLevel(l Level) {
+	level.Store(int32(l))
+}
+
+// SetFormat sets the line format of all loggers
+func SetFormat(f Format) {
+	format.Store(int32(f))
+}
+
+// CurrentLevel returns the minimum level of all loggers
+func CurrentLevel() Level {
+	return currentLevel()
+}
+
+func currentLevel() Level {
+	return Level(level.Load())
+}
+
+func currentFormat() Format {
+	return Format(format.Load())
+}
+
+// With returns a logger that writes to the same file with the key-value pairs attached to every line, e.g.:
+//
+//	log.With("distro", name, "request", id).Infof("...")
+//
+// The returned logger must not be closed, close the original one instead.
+func (c *Context) With(kv ...any) *Context {
+	fields := make([]any, 0, len(c.fields)+len(kv))
+	fields = append(fields, c.fields...)
+	fields = append(fields, kv...)
+
+	return &Context{
+		path:       c.path,
+		name:       c.name,
+		isChild:    c.isChild,
+		fields:     fields,
+		syncWriter: c.syncWriter,
+	}
+}
+
+// formatFields formats the fields as ` key=value key2=value2`
+func formatFields(fields []any) string {
+	if len(fields) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	eachField(fields, func(k string, v any) {
+		s := fmt.Sprint(v)
+		if strings.ContainsAny(s, " \t\"=") {
+			s = fmt.Sprintf("%q", s)
+		}
+		_, _ = fmt.Fprintf(&sb, " %s=%s", k, s)
+	})
+
+	return sb.String()
+}
+
+// eachField walks the key-value pairs, a key without value is reported with the key `!BADKEY`
+func eachField(fields []any, fn func(k string, v any)) {
+	for i := 0; i < len(fields); i += 2 {
+		if i+1 >= len(fields) {
+			fn("!BADKEY", fields[i])
+			break
+		}
+
+		fn(fmt.Sprint(fields[i]), fields[i+1])
+	}
+}
+
+func (c *Context) jsonLine(t time.Time, l Level, message string) []byte {
+	m := map[string]any{}
+	eachField(c.fields, func(k string, v any) {
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		m[k] = v
+	})
+
+	m["time"] = t.Format(time.RFC3339Nano)
+	m["msg"] = message
+	if s := l.String(); s != "" {
+		m["level"] = s
+	}
+	if c.isChild {
+		m["child"] = true
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		data, _ = json.Marshal(map[string]any{
+			"time":  m["time"],
+			"level": l.String(),
+			"msg":   message,
+			"error": fmt.Sprintf("failed to marshal fields: %v", err),
+		})
+	}
+
+	return append(data, '\n')
+}
@@ -4,26 +4,27 @@
 package logger
 
 import (
+	"errors"
 	"fmt"
 	"os"
-	"path/filepath"
-	"strconv"
 	"sync"
 	"time"
 )
 
-const logCount = 5
-
 var cs = make([]*Context, 0, 10)
 
+// textTimeLayout is the time layout at the beginning of the text line
+const textTimeLayout = "2006-01-02 15:04:05.000"
+
 // New creates a new log file
 func New(p, n string) (*Context, error) {
 	c := &Context{
 		path: p,
 		name: n,
-		syncWriter: syncWriter{
-			m:    sync.Mutex{},
-			file: nil,
+		syncWriter: &syncWriter{
+			m:         sync.Mutex{},
+			file:      nil,
+			rotatable: true,
 		},
 	}
 	if err := c.createLog(); err != nil {
@@ -43,7 +44,7 @@ func NewWithChildProcess(p, n string) (*Context, error) {
 		path:    p,
 		name:    n,
 		isChild: true,
-		syncWriter: syncWriter{
+		syncWriter: &syncWriter{
 			m:    sync.Mutex{},
 			file: nil,
 		},
@@ -64,7 +65,7 @@ func NewOnlyCreate(p, n string) (string, error) {
 	c := &Context{
 		path: p,
 		name: n,
-		syncWriter: syncWriter{
+		syncWriter: &syncWriter{
 			m:    sync.Mutex{},
 			file: nil,
 		},
@@ -90,55 +91,69 @@ func CloseAll() {
 type syncWriter struct {
 	m    sync.Mutex
 	file *os.File
+
+	// the fields below are used to rotate the file while running, see rotate.go
+	path        string
+	name        string
+	rotatable   bool
+	size        int64
+	openedAt    time.Time
+	lastFailure time.Time
+	compressing sync.WaitGroup
+
+	// followers receive the written lines, see follow.go
+	followers []*Follower
 }
 
 func (w *syncWriter) write(b []byte) (n int, err error) {
 	w.m.Lock()
 	defer w.m.Unlock()
-	return w.file.Write(b)
+
+	if w.rotatable {
+		w.maybeRotate(len(b))
+	}
+
+	n, err = w.file.Write(b)
+	w.size += int64(n)
+	w.publish(b)
+	return n, err
 }
 
 type Context struct {
 	path    string
 	name    string
 	isChild bool
-	syncWriter
+	// fields are the key-value pairs attached to every line, see [Context.With]
+	fields []any
+	*syncWriter
 }
 
 func (c *Context) createLog() error {
-	count := logCount
-	for i := count - 1; i > 0; i-- {
-		logName := c.name
-		if i > 1 {
-			logName += "." + strconv.Itoa(i)
-		}
-		logPath := filepath.Join(c.path, logName+".log")
-
-		if _, err := os.Stat(logPath); err == nil {
-			err := os.Rename(logPath, filepath.Join(c.path, c.name+"."+strconv.Itoa(i+1)+".log"))
-			if err != nil {
-				return fmt.Errorf("cannot rename log file: %v", err)
-			}
-		}
+	r := currentRotation()
+	if err := shiftFiles(c.path, c.name, r.Keep); err != nil {
+		return err
+	}
 
-		if i == 1 {
-			f, err := os.OpenFile(logPath, os.O_CREATE|os.O_APPEND|os.O_RDWR|os.O_TRUNC, 0644)
-			if err != nil {
-				return fmt.Errorf("cannot open log file: %v", err)
-			}
-			c.file = f
-		}
+	f, err := os.OpenFile(logFile(c.path, c.name, 1), os.O_CREATE|os.O_APPEND|os.O_RDWR|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("cannot open log file: %v", err)
+	}
+	c.file = f
+	c.syncWriter.path = c.path
+	c.syncWriter.name = c.name
+	c.size = 0
+	c.openedAt = time.Now()
+
+	if r.Compress {
+		c.compressRotated()
 	}
+
 	return nil
 }
 
 func (c *Context) useExistLog() error {
-	for i := 1; i <= logCount; i++ {
-		logName := c.name
-		if i > 1 {
-			logName += "." + strconv.Itoa(i)
-		}
-		logPath := filepath.Join(c.path, logName+".log")
+	for i := 1; i <= currentRotation().Keep; i++ {
+		logPath := logFile(c.path, c.name, i)
 
 		if _, err := os.Stat(logPath); err != nil {
 			continue
@@ -160,12 +175,29 @@ func (c *Context) NewWithAppendName(name string) (*Context, error) {
 }
 
 func (c *Context) base(t, message string) {
-	d := time.Now().Format("2006-01-02 15:04:05.000")
+	c.log(levelRaw, t, message)
+}
+
+func (c *Context) log(l Level, t, message string) {
+	if l != levelRaw && l < currentLevel() {
+		return
+	}
+
+	now := time.Now()
+
+	if currentFormat() == FormatJSON {
+		_, _ = c.write(c.jsonLine(now, l, message))
+		return
+	}
+
+	d := now.Format(textTimeLayout)
 	tag := ""
 	if t != "" {
 		tag = fmt.Sprintf("[%s]: ", t)
 	}
 
+	message += formatFields(c.fields)
+
 	if c.isChild {
 		_, _ = c.write([]byte(fmt.Sprintf("%s [CHILD] %s%s\n", d, tag, message)))
 	} else {
@@ -181,8 +213,28 @@ func (c *Context) Rawf(format string, args ...any) {
 	c.Raw(fmt.Sprintf(format, args...))
 }
 
+func (c *Context) Trace(message string) {
+	c.log(LevelTrace, "TRACE", message)
+}
+
+func (c *Context) Tracef(format string, args ...any) {
+	if LevelTrace >= currentLevel() {
+		c.Trace(fmt.Sprintf(format, args...))
+	}
+}
+
+func (c *Context) Debug(message string) {
+	c.log(LevelDebug, "DEBUG", message)
+}
+
+func (c *Context) Debugf(format string, args ...any) {
+	if LevelDebug >= currentLevel() {
+		c.Debug(fmt.Sprintf(format, args...))
+	}
+}
+
 func (c *Context) Info(message string) {
-	c.base("INFO", message)
+	c.log(LevelInfo, "INFO", message)
 }
 
 func (c *Context) Infof(format string, args ...any) {
@@ -190,7 +242,7 @@ func (c *Context) Infof(format string, args ...any) {
 }
 
 func (c *Context) Warn(message string) {
-	c.base("WARN", message)
+	c.log(LevelWarn, "WARN", message)
 	_ = c.file.Sync()
 }
 
@@ -199,9 +251,9 @@ func (c *Context) Warnf(format string, args ...any) {
 }
 
 func (c *Context) Error(message string) error {
-	c.base("ERROR", message)
+	c.log(LevelError, "ERROR", message)
 	_ = c.file.Sync()
-	return fmt.Errorf(message)
+	return errors.New(message)
 }
 
 func (c *Context) Errorf(format string, args ...any) error {
@@ -209,6 +261,12 @@ func (c *Context) Errorf(format string, args ...any) error {
 }
 
 func (c *Context) Close() {
+	c.m.Lock()
+	for len(c.followers) != 0 {
+		c.removeFollower(c.followers[0])
+	}
+	c.m.Unlock()
+
 	_ = c.file.Close()
 
 	for i, context := range cs {
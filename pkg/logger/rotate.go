@@ -0,0 +1,216 @@
+// SPDX-FileCopyrightText: 2025 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package logger
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Rotation is the rotation and retention policy of the log files.
+//
+// The current file is name.log, the rotated files are name.2.log, name.3.log ... (name.2.log.gz if compressed).
+type Rotation struct {
+	// MaxSize rotates the file when it would exceed this many bytes, 0 disables
+	MaxSize int64
+	// MaxAge rotates the file when it has been written for this long, 0 disables
+	MaxAge time.Duration
+	// Keep is the number of files kept, including the current one
+	Keep int
+	// Compress gzips the rotated files
+	Compress bool
+}
+
+const (
+	defaultMaxSize = 50 << 20
+	defaultKeep    = 5
+
+	// rotateRetry is the interval to retry after the rotation failed,
+	// e.g. the file is still opened by the child process (see [NewWithChildProcess])
+	rotateRetry = time.Minute
+)
+
+var rotation atomic.Pointer[Rotation]
+
+func init() {
+	rotation.Store(&Rotation{
+		MaxSize: defaultMaxSize,
+		Keep:    defaultKeep,
+	})
+}
+
+// SetRotation sets the rotation policy of all loggers
+func SetRotation(r Rotation) {
+	if r.Keep < 1 {
+		r.Keep = 1
+	}
+
+	rotation.Store(&r)
+}
+
+func currentRotation() Rotation {
+	return *rotation.Load()
+}
+
+// logFile returns the path of the i-th log file, the 1st is the current one
+func logFile(path, name string, i int) string {
+	if i <= 1 {
+		return filepath.Join(path, name+".log")
+	}
+
+	return filepath.Join(path, name+"."+strconv.Itoa(i)+".log")
+}
+
+// shiftFiles renames name.log to name.2.log, name.2.log to name.3.log ..., and removes the ones beyond keep
+func shiftFiles(path, name string, keep int) error {
+	for i := max(keep, 1); i >= 1; i-- {
+		for _, ext := range []string{"", ".gz"} {
+			src := logFile(path, name, i) + ext
+			if _, err := os.Stat(src); err != nil {
+				continue
+			}
+
+			if i >= keep {
+				if err := os.Remove(src); err != nil {
+					return fmt.Errorf("cannot remove log file: %v", err)
+				}
+				continue
+			}
+
+			if err := os.Rename(src, logFile(path, name, i+1)+ext); err != nil {
+				return fmt.Errorf("cannot rename log file: %v", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// maybeRotate rotates the file if the policy requires, the caller must hold the lock
+func (w *syncWriter) maybeRotate(next int) {
+	r := currentRotation()
+	if w.size == 0 {
+		return
+	}
+
+	bySize := r.MaxSize > 0 && w.size+int64(next) > r.MaxSize
+	byAge := r.MaxAge > 0 && time.Since(w.openedAt) > r.MaxAge
+	if !bySize && !byAge {
+		return
+	}
+
+	if time.Since(w.lastFailure) < rotateRetry {
+		return
+	}
+
+	if err := w.rotate(r); err != nil {
+		w.lastFailure = time.Now()
+		msg := fmt.Sprintf("Failed to rotate log file, retry in %s: %v", rotateRetry, err)
+
+		var line []byte
+		if currentFormat() == FormatJSON {
+			line = (&Context{}).jsonLine(w.lastFailure, LevelWarn, msg)
+		} else {
+			line = []byte(fmt.Sprintf("%s [WARN]: %s\n", w.lastFailure.Format(textTimeLayout), msg))
+		}
+
+		n, _ := w.file.Write(line)
+		w.size += int64(n)
+	}
+}
+
+// rotate reopens the current file after shifting the files, the caller must hold the lock.
+//
+// If the files cannot be shifted, the current file is reopened in append mode.
+func (w *syncWriter) rotate(r Rotation) error {
+	// the previous rotated file may still be compressing
+	w.compressing.Wait()
+
+	_ = w.file.Sync()
+	_ = w.file.Close()
+
+	shiftErr := shiftFiles(w.path, w.name, r.Keep)
+
+	flag := os.O_CREATE | os.O_APPEND | os.O_RDWR
+	if shiftErr == nil {
+		flag |= os.O_TRUNC
+	}
+
+	f, err := os.OpenFile(logFile(w.path, w.name, 1), flag, 0644)
+	if err != nil {
+		// keep writing somewhere rather than panic on the closed file
+		f, _ = os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+		w.file = f
+		return fmt.Errorf("cannot reopen log file: %v", err)
+	}
+	w.file = f
+
+	if shiftErr != nil {
+		return shiftErr
+	}
+
+	w.size = 0
+	w.openedAt = time.Now()
+
+	if r.Compress && r.Keep > 1 {
+		w.compressRotated()
+	}
+
+	return nil
+}
+
+// compressRotated gzips name.2.log in the background
+func (w *syncWriter) compressRotated() {
+	src := logFile(w.path, w.name, 2)
+	if _, err := os.Stat(src); err != nil {
+		return
+	}
+
+	w.compressing.Add(1)
+	go func() {
+		defer w.compressing.Done()
+		_ = gzipFile(src)
+	}()
+}
+
+func gzipFile(src string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp := src + ".gz.tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(out)
+	_, err = io.Copy(zw, in)
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+
+	if err := os.Rename(tmp, src+".gz"); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+
+	_ = in.Close()
+	return os.Remove(src)
+}
@@ -0,0 +1,115 @@
+// SPDX-FileCopyrightText: 2025 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package logger
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Slog returns a [slog.Logger] that writes to this logger, so packages based on log/slog share the same file.
+func (c *Context) Slog() *slog.Logger {
+	return slog.New(&slogHandler{c: c})
+}
+
+type slogHandler struct {
+	c     *Context
+	group string
+}
+
+func toLevel(l slog.Level) Level {
+	switch {
+	case l < slog.LevelDebug:
+		return LevelTrace
+	case l < slog.LevelInfo:
+		return LevelDebug
+	case l < slog.LevelWarn:
+		return LevelInfo
+	case l < slog.LevelError:
+		return LevelWarn
+	default:
+		return LevelError
+	}
+}
+
+func (h *slogHandler) Enabled(_ context.Context, l slog.Level) bool {
+	return toLevel(l) >= currentLevel()
+}
+
+func (h *slogHandler) Handle(_ context.Context, r slog.Record) error {
+	var kv []any
+	r.Attrs(func(a slog.Attr) bool {
+		kv = append(kv, h.attr(a)...)
+		return true
+	})
+
+	c := h.c
+	if len(kv) != 0 {
+		c = c.With(kv...)
+	}
+
+	l := toLevel(r.Level)
+	c.log(l, tagOf(l), r.Message)
+	return nil
+}
+
+func (h *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var kv []any
+	for _, a := range attrs {
+		kv = append(kv, h.attr(a)...)
+	}
+
+	return &slogHandler{
+		c:     h.c.With(kv...),
+		group: h.group,
+	}
+}
+
+func (h *slogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+
+	return &slogHandler{
+		c:     h.c,
+		group: h.group + name + ".",
+	}
+}
+
+// attr flattens the attribute to key-value pairs, the keys of the group are prefixed with the group name
+func (h *slogHandler) attr(a slog.Attr) []any {
+	v := a.Value.Resolve()
+	if v.Kind() != slog.KindGroup {
+		if a.Key == "" {
+			return nil
+		}
+		return []any{h.group + a.Key, v.Any()}
+	}
+
+	sub := &slogHandler{c: h.c, group: h.group}
+	if a.Key != "" {
+		sub.group += a.Key + "."
+	}
+
+	var kv []any
+	for _, ga := range v.Group() {
+		kv = append(kv, sub.attr(ga)...)
+	}
+	return kv
+}
+
+func tagOf(l Level) string {
+	switch l {
+	case LevelTrace:
+		return "TRACE"
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	default:
+		return "ERROR"
+	}
+}
@@ -0,0 +1,54 @@
+// SPDX-FileCopyrightText: 2025 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package podman
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/oomol-lab/ovm-win/pkg/logger"
+	"github.com/oomol-lab/ovm-win/pkg/util"
+	"github.com/oomol-lab/ovm-win/pkg/winapi/npipe"
+)
+
+// ServeNpipe proxies the podman API onto the named pipe until the context is done
+func ServeNpipe(ctx context.Context, log *logger.Context, pipePath string, dial Dialer) error {
+	nl, err := npipe.Create(pipePath)
+	if err != nil {
+		return fmt.Errorf("failed to create podman npipe listener: %w", err)
+	}
+
+	context.AfterFunc(ctx, func() {
+		_ = nl.Close()
+	})
+
+	log.Infof("Podman API is proxied on %s", pipePath)
+
+	for {
+		conn, err := nl.Accept()
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return fmt.Errorf("failed to accept podman npipe connection: %w", err)
+		}
+
+		go proxy(ctx, log, conn, dial)
+	}
+}
+
+func proxy(ctx context.Context, log *logger.Context, conn net.Conn, dial Dialer) {
+	defer conn.Close()
+
+	upstream, err := dial(ctx)
+	if err != nil {
+		log.Warnf("Failed to connect to podman: %v", err)
+		return
+	}
+	defer upstream.Close()
+
+	util.Proxy(ctx, conn, upstream)
+}
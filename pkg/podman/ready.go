@@ -1,37 +1,223 @@
-// SPDX-FileCopyrightText: 2024 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-FileCopyrightText: 2024-2025 OOMOL, Inc. <https://www.oomol.com>
 // SPDX-License-Identifier: MPL-2.0
 
 package podman
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
 	"time"
-
-	"github.com/oomol-lab/ovm-win/pkg/util/request"
 )
 
 const (
-	timeout       = 10 * time.Second
-	retryInterval = 200 * time.Millisecond
+	DefaultReadyTimeout  = 10 * time.Second
+	DefaultReadyInterval = 200 * time.Millisecond
+
+	// attemptTimeout is the timeout of each probe request
+	attemptTimeout = time.Second
+	// maxAttempts is the number of latest attempts kept for diagnostics
+	maxAttempts = 20
 )
 
-func Ready(ctx context.Context, podmanPort int) error {
-	ctx, cancel := context.WithTimeout(ctx, timeout)
+// ErrUnreachable means podman cannot be connected
+var ErrUnreachable = errors.New("podman is unreachable")
+
+// ResponseError means podman is reachable, but it responds an error
+type ResponseError struct {
+	Path       string
+	StatusCode int
+	Body       string
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("podman responds %d on %s: %s", e.StatusCode, e.Path, e.Body)
+}
+
+// Version is the response of GET /version
+type Version struct {
+	Version    string `json:"Version"`
+	APIVersion string `json:"ApiVersion"`
+	OS         string `json:"Os"`
+	Arch       string `json:"Arch"`
+}
+
+// Attempt is the result of a probe
+type Attempt struct {
+	Time      time.Time `json:"time"`
+	Reachable bool      `json:"reachable"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// Dialer connects to the podman API
+type Dialer func(ctx context.Context) (net.Conn, error)
+
+// TCPDialer connects to the podman API on 127.0.0.1:port
+func TCPDialer(port int) Dialer {
+	return func(ctx context.Context) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	}
+}
+
+// ReadyOpt is the strategy of [Ready]
+type ReadyOpt struct {
+	Timeout  time.Duration
+	Interval time.Duration
+}
+
+var (
+	stateMux sync.Mutex
+	attempts []Attempt
+	version  *Version
+)
+
+func record(a Attempt, v *Version) {
+	stateMux.Lock()
+	defer stateMux.Unlock()
+
+	attempts = append(attempts, a)
+	if len(attempts) > maxAttempts {
+		attempts = attempts[len(attempts)-maxAttempts:]
+	}
+
+	if v != nil {
+		version = v
+	}
+}
+
+// Attempts returns the latest probe attempts
+func Attempts() []Attempt {
+	stateMux.Lock()
+	defer stateMux.Unlock()
+
+	return append([]Attempt(nil), attempts...)
+}
+
+// LastVersion returns the podman version of the last successful probe, nil if podman has never been ready
+func LastVersion() *Version {
+	stateMux.Lock()
+	defer stateMux.Unlock()
+
+	return version
+}
+
+// Ready probes podman until it is ready or the timeout is reached.
+//
+// The error wraps [ErrUnreachable] or [*ResponseError] of the last attempt.
+func Ready(ctx context.Context, log *slog.Logger, dial Dialer, opt ReadyOpt) (*Version, error) {
+	if opt.Timeout <= 0 {
+		opt.Timeout = DefaultReadyTimeout
+	}
+	if opt.Interval <= 0 {
+		opt.Interval = DefaultReadyInterval
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, opt.Timeout)
 	defer cancel()
 
-	// See: https://docs.podman.io/en/latest/_static/api.html?version=v4.0#tag/images-(compat)/operation/ImageList
-	url := fmt.Sprintf("http://127.0.0.1:%d/images/json", podmanPort)
+	n := 0
 	for {
-		if _, err := request.Get(ctx, url); err != nil {
-			if ctx.Err() != nil {
-				return ctx.Err()
-			}
+		n++
+		v, err := Probe(ctx, dial)
+		if err == nil {
+			log.Info("Podman is ready", "attempts", n, "version", v.Version, "apiVersion", v.APIVersion)
+			return v, nil
+		}
 
-			time.Sleep(retryInterval)
-			continue
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("podman is not ready after %d attempts in %s: %w", n, opt.Timeout, err)
+		case <-time.After(opt.Interval):
 		}
+	}
+}
+
+// Probe checks whether podman is available by GET /_ping and GET /version, the attempt is recorded
+func Probe(ctx context.Context, dial Dialer) (*Version, error) {
+	v, err := probe(ctx, dial)
+
+	a := Attempt{
+		Time:      time.Now(),
+		Reachable: !errors.Is(err, ErrUnreachable),
+	}
+	if err != nil {
+		a.Error = err.Error()
+	}
+	record(a, v)
+
+	return v, err
+}
+
+// Check is [Probe] without recording the attempt, for the status queries which are not a part of the readiness
+func Check(ctx context.Context, dial Dialer) (*Version, error) {
+	return probe(ctx, dial)
+}
+
+func probe(ctx context.Context, dial Dialer) (*Version, error) {
+	c := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return dial(ctx)
+			},
+		},
+	}
+	// the connection may hold a process (see the guest socket of wsl), do not keep it after the probe
+	defer c.CloseIdleConnections()
+
+	// See: https://docs.podman.io/en/latest/_static/api.html#tag/system-(compat)/operation/SystemPing
+	body, err := get(ctx, c, "/_ping")
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(string(body)) != "OK" {
+		return nil, &ResponseError{Path: "/_ping", StatusCode: http.StatusOK, Body: string(body)}
+	}
+
+	// See: https://docs.podman.io/en/latest/_static/api.html#tag/system-(compat)/operation/SystemVersion
+	body, err = get(ctx, c, "/version")
+	if err != nil {
+		return nil, err
+	}
+
+	v := &Version{}
+	if err := json.Unmarshal(body, v); err != nil {
+		return nil, &ResponseError{Path: "/version", StatusCode: http.StatusOK, Body: fmt.Sprintf("invalid json: %v", err)}
+	}
+
+	return v, nil
+}
+
+func get(ctx context.Context, c *http.Client, path string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, attemptTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://podman"+path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s request: %w", path, err)
+	}
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnreachable, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read %s response: %v", ErrUnreachable, path, err)
+	}
 
-		return nil
+	if resp.StatusCode != http.StatusOK {
+		return nil, &ResponseError{Path: path, StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(body))}
 	}
+
+	return body, nil
 }
@@ -0,0 +1,334 @@
+// SPDX-FileCopyrightText: 2025 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+// Package portforward forwards the TCP ports on the host to the ports in the distro.
+package portforward
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+
+	"github.com/oomol-lab/ovm-win/pkg/logger"
+	"github.com/oomol-lab/ovm-win/pkg/util"
+)
+
+var (
+	ErrConflict = errors.New("host port is already forwarded")
+	ErrReserved = errors.New("host port is reserved")
+	ErrOccupied = errors.New("host port is occupied")
+	ErrNotFound = errors.New("host port is not forwarded")
+)
+
+const defaultHostIP = "127.0.0.1"
+
+// Mapping maps the host port to the port in the distro
+type Mapping struct {
+	// HostIP is the address to listen on the host, default 127.0.0.1
+	HostIP    string `json:"hostIP"`
+	HostPort  int    `json:"hostPort"`
+	GuestPort int    `json:"guestPort"`
+}
+
+// Status is the mapping with its listening state
+type Status struct {
+	Mapping
+	Active bool   `json:"active"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Dialer connects to the port in the distro
+type Dialer func(ctx context.Context, port int) (net.Conn, error)
+
+type forward struct {
+	Mapping
+	ln  net.Listener
+	err error
+}
+
+// Manager manages the forwarded ports, and persists them to the file
+type Manager struct {
+	log      *logger.Context
+	path     string
+	dial     Dialer
+	reserved []int
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu       sync.Mutex
+	forwards map[int]*forward
+}
+
+// New creates the manager, the mappings are persisted to path ("" to disable persistence),
+// and the reserved ports (such as the podman port) cannot be forwarded.
+func New(log *logger.Context, path string, dial Dialer, reserved ...int) *Manager {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Manager{
+		log:      log,
+		path:     path,
+		dial:     dial,
+		reserved: reserved,
+		ctx:      ctx,
+		cancel:   cancel,
+		forwards: make(map[int]*forward),
+	}
+}
+
+// Restore starts forwarding the persisted mappings.
+//
+// The mapping that cannot be listened is kept (inactive with error), so it is not lost because of a temporary conflict.
+func (m *Manager) Restore() error {
+	if m.path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(m.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read port mappings %s: %w", m.path, err)
+	}
+
+	var list []Mapping
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("failed to unmarshal port mappings %s: %w", m.path, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dropped := false
+	for _, mp := range list {
+		if err := m.check(&mp); err != nil {
+			m.log.Warnf("Drop port mapping %+v: %v", mp, err)
+			dropped = true
+			continue
+		}
+
+		f := &forward{Mapping: mp}
+		if err := m.listen(f); err != nil {
+			m.log.Warnf("Failed to restore port mapping %+v: %v", mp, err)
+			f.err = err
+		}
+		m.forwards[mp.HostPort] = f
+	}
+
+	if dropped {
+		m.save()
+	}
+
+	m.log.Infof("Restored %d port mappings from %s", len(m.forwards), m.path)
+	return nil
+}
+
+// Add starts forwarding the mapping and persists it
+func (m *Manager) Add(mp Mapping) (*Status, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.check(&mp); err != nil {
+		return nil, err
+	}
+
+	f := &forward{Mapping: mp}
+	if err := m.listen(f); err != nil {
+		return nil, err
+	}
+	m.forwards[mp.HostPort] = f
+
+	m.save()
+
+	return f.status(), nil
+}
+
+// Remove stops forwarding the host port and removes it from the persisted mappings
+func (m *Manager) Remove(hostPort int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, ok := m.forwards[hostPort]
+	if !ok {
+		return fmt.Errorf("%w: %d", ErrNotFound, hostPort)
+	}
+
+	if f.ln != nil {
+		_ = f.ln.Close()
+	}
+	delete(m.forwards, hostPort)
+
+	m.save()
+	m.log.Infof("Port mapping %+v removed", f.Mapping)
+
+	return nil
+}
+
+// List returns the status of all mappings, ordered by host port
+func (m *Manager) List() []*Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	list := make([]*Status, 0, len(m.forwards))
+	for _, f := range m.forwards {
+		list = append(list, f.status())
+	}
+
+	slices.SortFunc(list, func(a, b *Status) int {
+		return a.HostPort - b.HostPort
+	})
+
+	return list
+}
+
+// Close stops forwarding all ports, the mappings are kept in the file
+func (m *Manager) Close() error {
+	m.cancel()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, f := range m.forwards {
+		if f.ln != nil {
+			_ = f.ln.Close()
+		}
+	}
+
+	return nil
+}
+
+func (m *Manager) validate(mp *Mapping) error {
+	if mp.HostIP == "" {
+		mp.HostIP = defaultHostIP
+	}
+
+	if net.ParseIP(mp.HostIP) == nil {
+		return fmt.Errorf("invalid host ip: %q", mp.HostIP)
+	}
+
+	if mp.HostPort <= 0 || mp.HostPort > 65535 {
+		return fmt.Errorf("invalid host port: %d", mp.HostPort)
+	}
+
+	if mp.GuestPort <= 0 || mp.GuestPort > 65535 {
+		return fmt.Errorf("invalid guest port: %d", mp.GuestPort)
+	}
+
+	return nil
+}
+
+// check validates the mapping, and makes sure it is neither forwarded nor reserved, the caller must hold the lock
+func (m *Manager) check(mp *Mapping) error {
+	if err := m.validate(mp); err != nil {
+		return err
+	}
+
+	if _, ok := m.forwards[mp.HostPort]; ok {
+		return fmt.Errorf("%w: %d", ErrConflict, mp.HostPort)
+	}
+
+	if slices.Contains(m.reserved, mp.HostPort) {
+		return fmt.Errorf("%w: %d", ErrReserved, mp.HostPort)
+	}
+
+	return nil
+}
+
+// listen starts forwarding the host port if it is not occupied, the caller must hold the lock
+func (m *Manager) listen(f *forward) error {
+	if err := util.PortOccupied(f.HostPort); err != nil {
+		return fmt.Errorf("%w: %v", ErrOccupied, err)
+	}
+
+	if err := m.start(f); err != nil {
+		return fmt.Errorf("%w: %v", ErrOccupied, err)
+	}
+
+	return nil
+}
+
+// start listens on the host port and serves the connections, the caller must hold the lock
+func (m *Manager) start(f *forward) error {
+	ln, err := net.Listen("tcp", net.JoinHostPort(f.HostIP, strconv.Itoa(f.HostPort)))
+	if err != nil {
+		return err
+	}
+
+	f.ln = ln
+	m.log.Infof("Forwarding %s to guest port %d", ln.Addr().String(), f.GuestPort)
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					m.log.Warnf("Failed to accept on %s: %v", ln.Addr().String(), err)
+				}
+				return
+			}
+
+			go m.serve(conn, f.GuestPort)
+		}
+	}()
+
+	return nil
+}
+
+func (m *Manager) serve(conn net.Conn, guestPort int) {
+	defer conn.Close()
+
+	guest, err := m.dial(m.ctx, guestPort)
+	if err != nil {
+		m.log.Warnf("Failed to connect to guest port %d: %v", guestPort, err)
+		return
+	}
+	defer guest.Close()
+
+	util.Proxy(m.ctx, conn, guest)
+}
+
+// save persists the mappings, the caller must hold the lock
+func (m *Manager) save() {
+	if m.path == "" {
+		return
+	}
+
+	list := make([]Mapping, 0, len(m.forwards))
+	for _, f := range m.forwards {
+		list = append(list, f.Mapping)
+	}
+
+	slices.SortFunc(list, func(a, b Mapping) int {
+		return a.HostPort - b.HostPort
+	})
+
+	data, err := json.Marshal(list)
+	if err != nil {
+		m.log.Warnf("Failed to marshal port mappings: %v", err)
+		return
+	}
+
+	if err := os.WriteFile(m.path, data, 0644); err != nil {
+		m.log.Warnf("Failed to save port mappings to %s: %v", m.path, err)
+	}
+}
+
+func (f *forward) status() *Status {
+	s := &Status{
+		Mapping: f.Mapping,
+		Active:  f.ln != nil,
+	}
+
+	if f.err != nil {
+		s.Error = f.err.Error()
+	}
+
+	return s
+}
@@ -3,7 +3,13 @@
 
 package types
 
-import "github.com/oomol-lab/ovm-win/pkg/logger"
+import (
+	"time"
+
+	"github.com/oomol-lab/ovm-win/pkg/initstate"
+	"github.com/oomol-lab/ovm-win/pkg/logger"
+	"github.com/oomol-lab/ovm-win/pkg/portforward"
+)
 
 type BasicOpt struct {
 	Name            string
@@ -16,10 +22,7 @@ type BasicOpt struct {
 
 type InitOpt struct {
 	IsElevatedProcess bool
-	CanReboot         bool
-	CanEnableFeature  bool
-	CanUpdateWSL      bool
-	CanFixWSLConfig   bool
+	State             *initstate.Machine
 
 	BasicOpt
 }
@@ -32,6 +35,38 @@ type RunOpt struct {
 	PodmanPort     int
 	StoppedWithAPI bool
 
+	// PreferredPodmanPort is the podman port specified by the user, 0 means the port of the last run (or a free one)
+	PreferredPodmanPort int
+	// PodmanPortFallback allows choosing another free port when the preferred port is taken
+	PodmanPortFallback bool
+	// PodmanNpipe proxies the podman API on the named pipe PodmanNpipePath
+	PodmanNpipe     bool
+	PodmanNpipePath string
+	// PodmanTCP serves the podman API on PodmanPort (forwarded to 127.0.0.1 by WSL),
+	// otherwise podman only listens on a socket in the distro, which is reached through the named pipe
+	PodmanTCP bool
+	// PodmanReadyTimeout and PodmanReadyInterval are the strategy of waiting for podman to be ready
+	PodmanReadyTimeout  time.Duration
+	PodmanReadyInterval time.Duration
+
+	// DataMigrationDryRun runs the data migration on a copy of the data and exits without any change
+	DataMigrationDryRun bool
+	// AllowDataRecreate confirms recreating the data when it cannot be migrated to the new data version
+	AllowDataRecreate bool
+
+	// RootFSSHA256 is the expected checksum of RootFSPath, "" means not checked
+	RootFSSHA256 string
+	// RootFSManifest is a file in the format of sha256sum which contains the checksum of RootFSPath, "" means none
+	RootFSManifest string
+
+	// AllowDowngrade allows the rootfs and data versions older than the ones in versions.json
+	AllowDowngrade bool
+
+	// OVMDMaxRestarts is the number of times ovmd can be restarted after crashing, 0 means never restart
+	OVMDMaxRestarts int
+
+	Ports *portforward.Manager
+
 	BasicOpt
 }
 
@@ -43,3 +78,20 @@ type MigrateOpt struct {
 
 	BasicOpt
 }
+
+type DoctorOpt struct {
+	Format string
+	// ProbeDistro invokes a registered distro to check virtualization, it boots the WSL2 utility VM
+	ProbeDistro bool
+
+	BasicOpt
+}
+
+type DiagnoseOpt struct {
+	// ImageDir is optional, the image related files are skipped if it is empty
+	ImageDir string
+	// Output is the path of the zip file, a file in LogPath is used if it is empty
+	Output string
+
+	BasicOpt
+}
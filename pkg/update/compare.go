@@ -0,0 +1,68 @@
+// SPDX-FileCopyrightText: 2025 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package update
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/go-version"
+	"github.com/oomol-lab/ovm-win/pkg/ipc/event"
+	"github.com/oomol-lab/ovm-win/pkg/types"
+)
+
+// ErrDowngrade means the requested version is older than the one in versions.json, see --allow-downgrade
+var ErrDowngrade = errors.New("downgrade is refused")
+
+// compareVersion compares the versions semantically, ok is false if either of them is not a version (e.g. a hash).
+//
+// The prerelease must be separated by `-`, otherwise a hash such as `3f2a9c1` would be parsed as `3.0.0-f2a9c1`.
+func compareVersion(a, b string) (cmp int, ok bool) {
+	va, err := version.NewSemver(a)
+	if err != nil {
+		return 0, false
+	}
+
+	vb, err := version.NewSemver(b)
+	if err != nil {
+		return 0, false
+	}
+
+	return va.Compare(vb), true
+}
+
+type downgrade struct {
+	Key  types.VersionKey `json:"key"`
+	From string           `json:"from"`
+	To   string           `json:"to"`
+}
+
+// versionChanged reports whether the version is changed from the one in versions.json.
+//
+// The unready update must have been rolled back before, so from is the version that has reached Ready.
+//
+// The versions are compared semantically if possible, so `1.0` and `v1.0.0` are the same.
+// It returns ErrDowngrade if the new version is older, unless the downgrade is allowed.
+func (c *Context) versionChanged(key types.VersionKey, from, to string) (bool, error) {
+	cmp, ok := compareVersion(from, to)
+	if !ok {
+		return from != to, nil
+	}
+
+	if cmp <= 0 {
+		return cmp < 0, nil
+	}
+
+	if !c.AllowDowngrade {
+		event.NotifyRun(event.DowngradeRefused, jsonString(&downgrade{
+			Key:  key,
+			From: from,
+			To:   to,
+		}))
+		return false, fmt.Errorf("%w: %s %s -> %s, use --allow-downgrade to force it", ErrDowngrade, key, from, to)
+	}
+
+	c.Logger.Warnf("Downgrading %s %s -> %s, because downgrade is allowed", key, from, to)
+	return true, nil
+}
@@ -0,0 +1,81 @@
+// SPDX-FileCopyrightText: 2025 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package update
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/oomol-lab/ovm-win/pkg/logger"
+	"github.com/oomol-lab/ovm-win/pkg/types"
+)
+
+func TestCompareVersion(t *testing.T) {
+	tests := []struct {
+		a, b string
+		cmp  int
+		ok   bool
+	}{
+		{"1.0", "v1.0.0", 0, true},
+		{"v1.2.0", "1.2", 0, true},
+		{"1.0.0", "1.1.0", -1, true},
+		{"v2.0.0", "v1.9.9", 1, true},
+		{"1.0.0-beta.1", "1.0.0", -1, true},
+		{"3f2a9c1", "3f2a9c1", 0, false},
+		{"3f2a9c1", "1.0.0", 0, false},
+		{"1.0.0", "abcdef0", 0, false},
+		{"", "1.0.0", 0, false},
+	}
+
+	for _, tt := range tests {
+		cmp, ok := compareVersion(tt.a, tt.b)
+		if cmp != tt.cmp || ok != tt.ok {
+			t.Errorf("compareVersion(%q, %q) = %d, %v, want %d, %v", tt.a, tt.b, cmp, ok, tt.cmp, tt.ok)
+		}
+	}
+}
+
+func TestVersionChanged(t *testing.T) {
+	log, err := logger.New(t.TempDir(), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(logger.CloseAll)
+
+	tests := []struct {
+		name           string
+		from, to       string
+		allowDowngrade bool
+		changed        bool
+		err            error
+	}{
+		{"same version in different forms", "1.0", "v1.0.0", false, false, nil},
+		{"upgrade", "v1.0.0", "v1.1.0", false, true, nil},
+		{"downgrade", "v1.1.0", "v1.0.0", false, false, ErrDowngrade},
+		{"allowed downgrade", "v1.1.0", "v1.0.0", true, true, nil},
+		{"same hash", "3f2a9c1", "3f2a9c1", false, false, nil},
+		{"different hashes", "3f2a9c1", "0b7e4d2", false, true, nil},
+		{"hash to version", "3f2a9c1", "v1.0.0", false, true, nil},
+		{"first version", "", "v1.0.0", false, true, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Context{
+				RunOpt: types.RunOpt{
+					AllowDowngrade: tt.allowDowngrade,
+					BasicOpt:       types.BasicOpt{Logger: log},
+				},
+			}
+
+			changed, err := c.versionChanged(types.VersionRootFS, tt.from, tt.to)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("versionChanged(%q, %q) error = %v, want %v", tt.from, tt.to, err, tt.err)
+			}
+			if changed != tt.changed {
+				t.Errorf("versionChanged(%q, %q) = %v, want %v", tt.from, tt.to, changed, tt.changed)
+			}
+		})
+	}
+}
@@ -9,74 +9,178 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/oomol-lab/ovm-win/pkg/logger"
 	"github.com/oomol-lab/ovm-win/pkg/util"
+	"github.com/oomol-lab/ovm-win/pkg/winapi/sys"
 	"github.com/oomol-lab/ovm-win/pkg/winapi/vhdx"
 	"github.com/oomol-lab/ovm-win/pkg/wsl"
 )
 
-func (c *Context) updateRootfs() error {
+// stopDistro syncs and terminates the distro if it is running
+func stopDistro(log *logger.Context, name string) error {
+	err := wsl.SafeSyncDisk(log, name)
+	switch {
+	case err == nil:
+		log.Infof("Shutting down distro: %s", name)
+		if err := wsl.Terminate(log, name); err != nil {
+			return fmt.Errorf("cannot terminate distro %s: %w", name, err)
+		}
+	case errors.Is(err, wsl.ErrDistroNotExist), errors.Is(err, wsl.ErrDistroNotRunning):
+		break
+	default:
+		return fmt.Errorf("cannot terminate distro %s in sync disk step: %w", name, err)
+	}
+
+	return nil
+}
+
+func (c *Context) stagingDistro() string {
+	return c.DistroName + "-staging"
+}
+
+// removeStaging removes the staging distro and the files left by the previous failed update
+func (c *Context) removeStaging() {
 	log := c.Logger
 
-	// Remove the old distro
-	{
-		err := wsl.SafeSyncDisk(log, c.DistroName)
-		switch {
-		case errors.Is(err, wsl.ErrDistroNotRunning), err == nil:
-			log.Infof("Removing old distro: %s", c.DistroName)
-			if err := wsl.Unregister(log, c.DistroName); err != nil {
-				return fmt.Errorf("cannot remove old distro %s: %w", c.DistroName, err)
-			}
-		case errors.Is(err, wsl.ErrDistroNotExist):
-			break
-		default:
-			return fmt.Errorf("cannot remove old distro %s in sync disk step: %w", c.DistroName, err)
+	if ok, err := wsl.IsRegister(log, c.stagingDistro()); err == nil && ok {
+		if err := wsl.Unregister(log, c.stagingDistro()); err != nil {
+			log.Warnf("Failed to remove staging distro: %v", err)
 		}
 	}
 
-	log.Infof("Importing distro %s from %s", c.DistroName, c.RootFSPath)
-	if err := wsl.ImportDistro(log, c.DistroName, c.ImageDir, c.RootFSPath); err != nil {
+	if err := os.RemoveAll(filepath.Join(c.ImageDir, "staging")); err != nil {
+		log.Warnf("Failed to remove staging dir: %v", err)
+	}
+}
+
+// stageRootfs imports the new rootfs under a temporary distro name and verifies it,
+// the result is left in ext4.vhdx.next without touching the current distro.
+func (c *Context) stageRootfs() error {
+	log := c.Logger
+	staging := c.stagingDistro()
+	dir := filepath.Join(c.ImageDir, "staging")
+
+	c.removeStaging()
+	defer c.removeStaging()
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create staging dir: %w", err)
+	}
+
+	log.Infof("Importing staging distro %s from %s", staging, c.RootFSPath)
+	if err := wsl.ImportDistro(log, staging, dir, c.RootFSPath); err != nil {
 		return fmt.Errorf("failed to import distro: %w", err)
 	}
 
+	if err := wsl.CheckRootFS(log, staging); err != nil {
+		return fmt.Errorf("failed to verify new rootfs: %w", err)
+	}
+
+	if err := wsl.Terminate(log, staging); err != nil {
+		return err
+	}
+
+	// the vhdx of the staging distro is removed along with the distro, so keep a copy
+	if err := sys.CopyFile(filepath.Join(dir, "ext4.vhdx"), c.nextPath("ext4.vhdx"), true); err != nil {
+		return fmt.Errorf("failed to copy staged rootfs: %w", err)
+	}
+
 	return nil
 }
 
-func (c *Context) updateData() error {
-	log := c.Logger
+// stageData creates the new data disk in data.vhdx.next
+func (c *Context) stageData() error {
+	next := c.nextPath("data.vhdx")
+	if err := os.RemoveAll(next); err != nil {
+		return fmt.Errorf("failed to remove %s: %w", next, err)
+	}
 
-	// Shutdown the distro
-	{
-		err := wsl.SafeSyncDisk(log, c.DistroName)
-		switch {
-		case err == nil:
-			log.Infof("Shutting down distro: %s", c.DistroName)
-			if err := wsl.Terminate(log, c.DistroName); err != nil {
-				return fmt.Errorf("cannot terminate distro %s: %w", c.DistroName, err)
-			}
-		case errors.Is(err, wsl.ErrDistroNotExist), errors.Is(err, wsl.ErrDistroNotRunning):
-			break
-		default:
-			return fmt.Errorf("cannot terminate distro %s in sync disk step: %w", c.DistroName, err)
-		}
+	dataSize := util.DataSize(c.Name)
+	c.Logger.Infof("Creating new data: %s, size: %d", next, dataSize)
+	if err := vhdx.Create(next, dataSize); err != nil {
+		return fmt.Errorf("failed to create new data: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Context) nextPath(name string) string {
+	return filepath.Join(c.ImageDir, name+".next")
+}
+
+// backupRootfs keeps a copy of the current ext4.vhdx for rollback
+func (c *Context) backupRootfs(tx *transaction) error {
+	rootfsPath := filepath.Join(c.ImageDir, "ext4.vhdx")
+	if util.Exists(rootfsPath) != nil {
+		return nil
+	}
+
+	if ok, err := wsl.IsRegister(c.Logger, c.DistroName); err != nil || !ok {
+		return err
 	}
 
+	c.Logger.Infof("Backing up rootfs: %s", rootfsPath)
+	if err := sys.CopyFile(rootfsPath, filepath.Join(rollbackDir(c.ImageDir), "ext4.vhdx"), true); err != nil {
+		return fmt.Errorf("failed to back up rootfs: %w", err)
+	}
+
+	tx.RootFS = true
+	return tx.save(c.ImageDir)
+}
+
+// backupData moves the current data.vhdx to the rollback directory
+func (c *Context) backupData(tx *transaction) error {
 	dataPath := filepath.Join(c.ImageDir, "data.vhdx")
 	sourceCodeDiskPath := filepath.Join(c.ImageDir, "sourcecode.vhdx")
 
-	log.Infof("Umounting data: %s, source code disk: %s", dataPath, sourceCodeDiskPath)
-	if err := wsl.UmountVHDX(log, dataPath, sourceCodeDiskPath); err != nil {
+	c.Logger.Infof("Umounting data: %s, source code disk: %s", dataPath, sourceCodeDiskPath)
+	if err := wsl.UmountVHDX(c.Logger, dataPath, sourceCodeDiskPath); err != nil {
 		return fmt.Errorf("failed to unmount data: %w", err)
 	}
 
-	log.Infof("Removing old data: %s", dataPath)
-	if err := os.RemoveAll(dataPath); err != nil {
-		return fmt.Errorf("failed to remove old data: %w", err)
+	if util.Exists(dataPath) != nil {
+		return nil
 	}
 
-	dataSize := util.DataSize(c.Name)
-	log.Infof("Creating new data: %s, size: %d", dataPath, dataSize)
-	if err := vhdx.Create(dataPath, dataSize); err != nil {
-		return fmt.Errorf("failed to create new data: %w", err)
+	c.Logger.Infof("Backing up data: %s", dataPath)
+	if err := os.Rename(dataPath, filepath.Join(rollbackDir(c.ImageDir), "data.vhdx")); err != nil {
+		return fmt.Errorf("failed to back up data: %w", err)
+	}
+
+	tx.Data = true
+	return tx.save(c.ImageDir)
+}
+
+// swapRootfs replaces the current distro with the staged rootfs
+func (c *Context) swapRootfs() error {
+	log := c.Logger
+	rootfsPath := filepath.Join(c.ImageDir, "ext4.vhdx")
+
+	if ok, err := wsl.IsRegister(log, c.DistroName); err != nil {
+		return fmt.Errorf("failed to check if distro %s is registered: %w", c.DistroName, err)
+	} else if ok {
+		log.Infof("Removing old distro: %s", c.DistroName)
+		if err := wsl.Unregister(log, c.DistroName); err != nil {
+			return fmt.Errorf("cannot remove old distro %s: %w", c.DistroName, err)
+		}
+	}
+
+	if err := os.Rename(c.nextPath("ext4.vhdx"), rootfsPath); err != nil {
+		return fmt.Errorf("failed to move staged rootfs: %w", err)
+	}
+
+	log.Infof("Registering distro %s with %s", c.DistroName, rootfsPath)
+	if err := wsl.ImportDistroInPlace(log, c.DistroName, rootfsPath); err != nil {
+		return fmt.Errorf("failed to register new rootfs: %w", err)
+	}
+
+	return nil
+}
+
+// swapData replaces the current data.vhdx with the staged one
+func (c *Context) swapData() error {
+	if err := os.Rename(c.nextPath("data.vhdx"), filepath.Join(c.ImageDir, "data.vhdx")); err != nil {
+		return fmt.Errorf("failed to move staged data: %w", err)
 	}
 
 	return nil
@@ -0,0 +1,107 @@
+// SPDX-FileCopyrightText: 2025 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package update
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/oomol-lab/ovm-win/pkg/types"
+)
+
+// ManifestSchema is the schema version of versions.json written by this binary.
+//
+// Schema 0 (no `schema` field) is the legacy format which only has `rootfs` and `data`.
+const ManifestSchema = 1
+
+// Manifest is the content of versions.json.
+//
+// The `rootfs` and `data` keys stay at the top level, so the older binaries are still able to read it.
+type Manifest struct {
+	Schema int `json:"schema"`
+	types.Version
+
+	RootFSInfo *RootFSRecord `json:"rootfsInfo,omitempty"`
+	DataInfo   *DataRecord   `json:"dataInfo,omitempty"`
+
+	// WrittenBy is the version of ovm-win which wrote the file
+	WrittenBy string    `json:"writtenBy"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	// History is the updates applied to the image directory, the oldest first
+	History []HistoryEntry `json:"history,omitempty"`
+}
+
+type RootFSRecord struct {
+	SHA256     string    `json:"sha256"`
+	Source     string    `json:"source"`
+	ImportedAt time.Time `json:"importedAt"`
+}
+
+type DataRecord struct {
+	// CreatedAt is zero if the disk was created before the record existed (legacy versions.json)
+	CreatedAt time.Time `json:"createdAt"`
+	// Size is the virtual size of the disk in bytes
+	Size uint64 `json:"size"`
+	// MigratedFrom is the data version migrated from by the last update, empty if the disk is created
+	MigratedFrom string `json:"migratedFrom,omitempty"`
+}
+
+type HistoryEntry struct {
+	Time time.Time `json:"time"`
+	// From is empty for the first installation
+	From      *types.Version     `json:"from,omitempty"`
+	To        types.Version      `json:"to"`
+	Updated   []types.VersionKey `json:"updated"`
+	SHA256    string             `json:"sha256,omitempty"`
+	WrittenBy string             `json:"writtenBy"`
+}
+
+func manifestPath(imageDir string) string {
+	return filepath.Join(imageDir, "versions.json")
+}
+
+// ReadManifest reads the versions.json in the imageDir, the legacy format is upgraded in memory
+func ReadManifest(imageDir string) (m *Manifest, legacy bool, err error) {
+	p := manifestPath(imageDir)
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read %s: %w", p, err)
+	}
+
+	m = &Manifest{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, false, fmt.Errorf("%w: failed to unmarshal %s, json content: %s, %v", ErrInvalidVersions, p, data, err)
+	}
+
+	if m.Schema == 0 {
+		m.Schema = ManifestSchema
+		legacy = true
+	}
+
+	return m, legacy, nil
+}
+
+// write writes the manifest through a temporary file, so versions.json is never half-written
+func (m *Manifest) write(imageDir string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal versions: %w", err)
+	}
+
+	p := manifestPath(imageDir)
+	tmp := p + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write versions to %s: %w", tmp, err)
+	}
+
+	if err := os.Rename(tmp, p); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to rename %s: %w", tmp, err)
+	}
+
+	return nil
+}
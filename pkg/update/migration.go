@@ -0,0 +1,236 @@
+// SPDX-FileCopyrightText: 2025 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package update
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/oomol-lab/ovm-win/pkg/ipc/event"
+	"github.com/oomol-lab/ovm-win/pkg/util"
+	"github.com/oomol-lab/ovm-win/pkg/winapi/sys"
+	"github.com/oomol-lab/ovm-win/pkg/wsl"
+)
+
+// Migration migrates the data disk from the data version From to To.
+//
+// Script runs as root in the distro with the data disk mounted at $OVM_DATA (also the working directory),
+// $OVM_DATA_FROM and $OVM_DATA_TO are the versions, $OVM_DRY_RUN is 1 in the dry-run mode.
+// It runs on a copy of the data disk, the original one is kept for rollback.
+type Migration struct {
+	From   string
+	To     string
+	Name   string
+	Script string
+}
+
+// migrations are the known steps, add one when the data version changes, e.g.:
+//
+//	{From: "1", To: "2", Name: "move volumes", Script: `mv containers/volumes volumes`},
+//
+// A step with an empty script means the versions are compatible.
+var migrations []Migration
+
+var (
+	// ErrDryRun is returned after the dry run of the data migration, nothing is changed
+	ErrDryRun = errors.New("data migration dry run finished")
+	// ErrNoMigration means the data cannot be migrated, and recreating it is not allowed
+	ErrNoMigration = errors.New("no data migration path, recreating data needs confirmation")
+)
+
+// migrationPath finds the shortest steps from the version to another, ok is false if there is no path
+func migrationPath(steps []Migration, from, to string) (path []Migration, ok bool) {
+	if from == to {
+		return nil, true
+	}
+
+	prev := map[string]int{from: -1}
+	queue := []string{from}
+	for len(queue) != 0 {
+		v := queue[0]
+		queue = queue[1:]
+
+		for i, s := range steps {
+			if s.From != v {
+				continue
+			}
+			if _, seen := prev[s.To]; seen {
+				continue
+			}
+
+			prev[s.To] = i
+			if s.To != to {
+				queue = append(queue, s.To)
+				continue
+			}
+
+			for j := i; j != -1; j = prev[steps[j].From] {
+				path = append([]Migration{steps[j]}, path...)
+			}
+			return path, true
+		}
+	}
+
+	return nil, false
+}
+
+type migrationPlan struct {
+	From   string   `json:"from"`
+	To     string   `json:"to"`
+	Steps  []string `json:"steps"`
+	DryRun bool     `json:"dryRun"`
+}
+
+type migrationStep struct {
+	Index int    `json:"index"`
+	Total int    `json:"total"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Name  string `json:"name"`
+	Error string `json:"error,omitempty"`
+}
+
+func jsonString(v any) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// migrateData copies the data disk to data.vhdx.next, and runs the steps on the copy
+func (c *Context) migrateData(from string, steps []Migration) error {
+	log := c.Logger
+	dataPath := filepath.Join(c.ImageDir, "data.vhdx")
+	next := c.nextPath("data.vhdx")
+
+	names := make([]string, 0, len(steps))
+	for _, s := range steps {
+		names = append(names, s.Name)
+	}
+	log.Infof("Migrating data %s -> %s, steps: %s, dry run: %t", from, c.Data, strings.Join(names, ", "), c.DataMigrationDryRun)
+	event.NotifyRun(event.DataMigrating, jsonString(&migrationPlan{
+		From:   from,
+		To:     c.Data,
+		Steps:  names,
+		DryRun: c.DataMigrationDryRun,
+	}))
+
+	if ok, err := wsl.IsRegister(log, c.DistroName); err != nil || !ok {
+		return fmt.Errorf("distro %s is required to migrate data: registered: %t, %v", c.DistroName, ok, err)
+	}
+
+	// the original disk must not be attached, it has the same size as the copy
+	if err := stopDistro(log, c.DistroName); err != nil {
+		return err
+	}
+	if err := wsl.UmountVHDX(log, dataPath, filepath.Join(c.ImageDir, "sourcecode.vhdx")); err != nil {
+		return fmt.Errorf("failed to unmount data: %w", err)
+	}
+
+	log.Infof("Copying data %s to %s", dataPath, next)
+	if err := sys.CopyFile(dataPath, next, true); err != nil {
+		return fmt.Errorf("failed to copy data: %w", err)
+	}
+	defer func() {
+		if err := wsl.Terminate(log, c.DistroName); err != nil {
+			log.Warnf("Failed to terminate distro after migration: %v", err)
+		}
+	}()
+
+	dryRun := "0"
+	if c.DataMigrationDryRun {
+		dryRun = "1"
+	}
+
+	// Backward compatibility, see wsl.launchOVMD
+	sectors := []uint64{util.DataSize(c.Name) / 512, util.DataSize(c.Name+c.ImageDir) / 512}
+
+	for i, s := range steps {
+		step := &migrationStep{
+			Index: i + 1,
+			Total: len(steps),
+			From:  s.From,
+			To:    s.To,
+			Name:  s.Name,
+		}
+		event.NotifyRun(event.DataMigrationStep, jsonString(step))
+
+		if strings.TrimSpace(s.Script) == "" {
+			log.Infof("Data migration step %d/%d %s -> %s: nothing to do", step.Index, step.Total, s.From, s.To)
+			continue
+		}
+
+		var out bytes.Buffer
+		err := wsl.RunOnDataDisk(context.Background(), log, c.DistroName, next, sectors, map[string]string{
+			"OVM_DATA_FROM": s.From,
+			"OVM_DATA_TO":   s.To,
+			"OVM_DRY_RUN":   dryRun,
+		}, s.Script, &out, &out)
+		log.Infof("Data migration step %d/%d %s -> %s (%s) output:\n%s", step.Index, step.Total, s.From, s.To, s.Name, out.String())
+
+		if err != nil {
+			step.Error = err.Error()
+			event.NotifyRun(event.DataMigrationStepFailed, jsonString(step))
+			return fmt.Errorf("data migration step %s -> %s failed: %w", s.From, s.To, err)
+		}
+	}
+
+	event.NotifyRun(event.DataMigrationSuccess)
+	return nil
+}
+
+// prepareData stages the data disk of the new version in data.vhdx.next.
+//
+// The current data is migrated if there is a path, otherwise an empty disk is created
+// only when there is no current data or the user has confirmed (--allow-data-recreate).
+func (c *Context) prepareData() error {
+	log := c.Logger
+	dataPath := filepath.Join(c.ImageDir, "data.vhdx")
+
+	if util.Exists(dataPath) != nil {
+		if c.DataMigrationDryRun {
+			log.Info("Dry run: no data to migrate, a new data disk will be created")
+			return ErrDryRun
+		}
+		return c.stageData()
+	}
+
+	// the data version is unknown if versions.json is missing or invalid, it cannot be migrated
+	from := ""
+	if c.current != nil {
+		from = c.current.Data
+	}
+
+	if steps, ok := migrationPath(migrations, from, c.Data); ok && from != "" {
+		if err := c.migrateData(from, steps); err != nil {
+			return err
+		}
+		if c.DataMigrationDryRun {
+			return ErrDryRun
+		}
+		c.dataMigratedFrom = from
+		return nil
+	}
+
+	log.Warnf("No data migration path from %q to %s", from, c.Data)
+	if c.DataMigrationDryRun || !c.AllowDataRecreate {
+		event.NotifyRun(event.DataRecreateRequired, jsonString(&migrationPlan{
+			From:   from,
+			To:     c.Data,
+			DryRun: c.DataMigrationDryRun,
+		}))
+	}
+	if c.DataMigrationDryRun {
+		return ErrDryRun
+	}
+	if !c.AllowDataRecreate {
+		return ErrNoMigration
+	}
+
+	log.Warnf("Recreating data as confirmed, the previous data is kept until the new version is ready")
+	return c.stageData()
+}
@@ -0,0 +1,54 @@
+// SPDX-FileCopyrightText: 2025 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package update
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMigrationPath(t *testing.T) {
+	steps := []Migration{
+		{From: "1", To: "2", Name: "1-2"},
+		{From: "2", To: "3", Name: "2-3"},
+		{From: "3", To: "4", Name: "3-4"},
+		{From: "2", To: "4", Name: "2-4"},
+		{From: "4", To: "2", Name: "4-2"},
+		{From: "5", To: "6", Name: "5-6"},
+		{From: "6", To: "5", Name: "6-5"},
+	}
+
+	tests := []struct {
+		name     string
+		from, to string
+		want     []string
+		ok       bool
+	}{
+		{"same version", "1", "1", nil, true},
+		{"direct step", "1", "2", []string{"1-2"}, true},
+		{"multiple hops", "1", "3", []string{"1-2", "2-3"}, true},
+		{"shortest path", "1", "4", []string{"1-2", "2-4"}, true},
+		{"through a cycle", "4", "3", []string{"4-2", "2-3"}, true},
+		{"no path", "3", "1", nil, false},
+		{"no path in a cycle", "5", "7", nil, false},
+		{"unknown version", "0", "2", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, ok := migrationPath(steps, tt.from, tt.to)
+			if ok != tt.ok {
+				t.Fatalf("migrationPath(%q, %q) ok = %v, want %v", tt.from, tt.to, ok, tt.ok)
+			}
+
+			var names []string
+			for _, s := range path {
+				names = append(names, s.Name)
+			}
+			if !slices.Equal(names, tt.want) {
+				t.Errorf("migrationPath(%q, %q) = %v, want %v", tt.from, tt.to, names, tt.want)
+			}
+		})
+	}
+}
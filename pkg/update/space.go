@@ -0,0 +1,74 @@
+// SPDX-FileCopyrightText: 2025 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package update
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/windows"
+)
+
+var ErrNoSpace = errors.New("not enough disk space for the update")
+
+// rootfsExpandRatio estimates the size of the imported rootfs from the size of its archive
+const rootfsExpandRatio = 2
+
+// requiredSpace estimates the disk space needed by the update in the image directory:
+//   - rootfs: the archive is imported into the staging distro and copied to ext4.vhdx.next,
+//     and the current ext4.vhdx is copied to the rollback directory
+//   - data: the current data.vhdx is copied to data.vhdx.next for the migration,
+//     it is moved (not copied) to the rollback directory
+func (c *Context) requiredSpace(updateData, updateRootFS bool) uint64 {
+	var need uint64
+
+	if updateRootFS {
+		need += 2 * rootfsExpandRatio * fileSize(c.RootFSPath)
+		need += fileSize(filepath.Join(c.ImageDir, "ext4.vhdx"))
+	}
+
+	if updateData {
+		need += fileSize(filepath.Join(c.ImageDir, "data.vhdx"))
+	}
+
+	return need
+}
+
+// checkFreeSpace makes sure the volume of the image directory has enough space before anything is copied,
+// a full disk in the middle of the update only leaves the staged files behind
+func (c *Context) checkFreeSpace(updateData, updateRootFS bool) error {
+	need := c.requiredSpace(updateData, updateRootFS)
+	if need == 0 {
+		return nil
+	}
+
+	p, err := windows.UTF16PtrFromString(c.ImageDir)
+	if err != nil {
+		return fmt.Errorf("failed to convert %s: %w", c.ImageDir, err)
+	}
+
+	var free uint64
+	if err := windows.GetDiskFreeSpaceEx(p, &free, nil, nil); err != nil {
+		c.Logger.Warnf("Failed to get free space of %s, skip checking: %v", c.ImageDir, err)
+		return nil
+	}
+
+	c.Logger.Infof("Update needs about %d bytes, free space: %d bytes", need, free)
+	if free < need {
+		return fmt.Errorf("%w: need about %d bytes, only %d bytes free in %s", ErrNoSpace, need, free, c.ImageDir)
+	}
+
+	return nil
+}
+
+func fileSize(p string) uint64 {
+	info, err := os.Stat(p)
+	if err != nil {
+		return 0
+	}
+
+	return uint64(info.Size())
+}
@@ -0,0 +1,197 @@
+// SPDX-FileCopyrightText: 2025 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package update
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/oomol-lab/ovm-win/pkg/ipc/event"
+	"github.com/oomol-lab/ovm-win/pkg/logger"
+	"github.com/oomol-lab/ovm-win/pkg/types"
+	"github.com/oomol-lab/ovm-win/pkg/util"
+	"github.com/oomol-lab/ovm-win/pkg/wsl"
+)
+
+// transaction is the record of an update which has not reached Ready yet, stored in `rollback/transaction.json`.
+//
+// The previous files are kept in the rollback directory until the transaction is committed:
+//   - rollback/ext4.vhdx: the previous rootfs, if RootFS is true
+//   - rollback/data.vhdx: the previous data, if Data is true
+//   - rollback/versions.json: the previous versions.json, if it existed
+type transaction struct {
+	RootFS bool      `json:"rootfs"`
+	Data   bool      `json:"data"`
+	Time   time.Time `json:"time"`
+}
+
+func rollbackDir(imageDir string) string {
+	return filepath.Join(imageDir, "rollback")
+}
+
+func readTransaction(imageDir string) (*transaction, error) {
+	data, err := os.ReadFile(filepath.Join(rollbackDir(imageDir), "transaction.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	tx := &transaction{}
+	if err := json.Unmarshal(data, tx); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal transaction: %w", err)
+	}
+
+	return tx, nil
+}
+
+func (tx *transaction) save(imageDir string) error {
+	data, err := json.Marshal(tx)
+	if err != nil {
+		return fmt.Errorf("failed to marshal transaction: %w", err)
+	}
+
+	p := filepath.Join(rollbackDir(imageDir), "transaction.json")
+	if err := os.WriteFile(p, data, 0644); err != nil {
+		return fmt.Errorf("failed to write transaction to %s: %w", p, err)
+	}
+
+	return nil
+}
+
+// Pending reports whether there is an update which has not reached Ready yet
+func Pending(imageDir string) bool {
+	_, err := readTransaction(imageDir)
+	return err == nil
+}
+
+// Commit removes the previous rootfs and data kept for rollback, it is called once the new version is ready
+func Commit(log *logger.Context, imageDir string) error {
+	if !Pending(imageDir) {
+		return nil
+	}
+
+	log.Infof("Update has reached ready, removing the rollback files in %s", rollbackDir(imageDir))
+	if err := os.RemoveAll(rollbackDir(imageDir)); err != nil {
+		return fmt.Errorf("failed to remove rollback files: %w", err)
+	}
+
+	return nil
+}
+
+// Rollback restores the previous rootfs, data and versions.json of the pending update
+func Rollback(opt *types.RunOpt) error {
+	log := opt.Logger
+
+	tx, err := readTransaction(opt.ImageDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Rolling back the update at %s, rootfs: %t, data: %t", tx.Time.Format(time.RFC3339), tx.RootFS, tx.Data)
+	event.NotifyRun(event.RollingBack)
+
+	if err := rollback(opt, tx); err != nil {
+		event.NotifyRun(event.RollbackFailed, err.Error())
+		return fmt.Errorf("failed to roll back: %w", err)
+	}
+
+	if err := os.RemoveAll(rollbackDir(opt.ImageDir)); err != nil {
+		log.Warnf("Failed to remove rollback files: %v", err)
+	}
+
+	event.NotifyRun(event.RollbackSuccess)
+	log.Info("Rollback success")
+	return nil
+}
+
+func rollback(opt *types.RunOpt, tx *transaction) error {
+	log := opt.Logger
+	dir := rollbackDir(opt.ImageDir)
+
+	if err := stopDistro(log, opt.DistroName); err != nil {
+		return err
+	}
+
+	if tx.Data {
+		if err := restoreData(opt); err != nil {
+			return err
+		}
+	}
+
+	if tx.RootFS {
+		if err := restoreRootfs(opt); err != nil {
+			return err
+		}
+	}
+
+	jsonPath := filepath.Join(opt.ImageDir, "versions.json")
+	prev := filepath.Join(dir, "versions.json")
+	if util.Exists(prev) == nil {
+		if err := os.Rename(prev, jsonPath); err != nil {
+			return fmt.Errorf("failed to restore versions.json: %w", err)
+		}
+	} else if err := os.RemoveAll(jsonPath); err != nil {
+		return fmt.Errorf("failed to remove versions.json: %w", err)
+	}
+
+	return nil
+}
+
+// restoreRootfs registers the distro with the previous ext4.vhdx
+func restoreRootfs(opt *types.RunOpt) error {
+	log := opt.Logger
+	prev := filepath.Join(rollbackDir(opt.ImageDir), "ext4.vhdx")
+	rootfsPath := filepath.Join(opt.ImageDir, "ext4.vhdx")
+
+	if err := util.Exists(prev); err != nil {
+		return fmt.Errorf("previous rootfs is missing: %w", err)
+	}
+
+	if ok, err := wsl.IsRegister(log, opt.DistroName); err != nil {
+		return fmt.Errorf("failed to check if distro %s is registered: %w", opt.DistroName, err)
+	} else if ok {
+		if err := wsl.Unregister(log, opt.DistroName); err != nil {
+			return fmt.Errorf("cannot remove new distro %s: %w", opt.DistroName, err)
+		}
+	}
+
+	log.Infof("Restoring rootfs: %s", rootfsPath)
+	if err := os.Rename(prev, rootfsPath); err != nil {
+		return fmt.Errorf("failed to restore rootfs: %w", err)
+	}
+
+	if err := wsl.ImportDistroInPlace(log, opt.DistroName, rootfsPath); err != nil {
+		return fmt.Errorf("failed to register previous rootfs: %w", err)
+	}
+
+	return nil
+}
+
+// restoreData moves the previous data.vhdx back
+func restoreData(opt *types.RunOpt) error {
+	log := opt.Logger
+	prev := filepath.Join(rollbackDir(opt.ImageDir), "data.vhdx")
+	dataPath := filepath.Join(opt.ImageDir, "data.vhdx")
+
+	if err := util.Exists(prev); err != nil {
+		return fmt.Errorf("previous data is missing: %w", err)
+	}
+
+	if err := wsl.UmountVHDX(log, dataPath); err != nil {
+		return fmt.Errorf("failed to unmount data: %w", err)
+	}
+
+	log.Infof("Restoring data: %s", dataPath)
+	if err := os.Rename(prev, dataPath); err != nil {
+		return fmt.Errorf("failed to restore data: %w", err)
+	}
+
+	return nil
+}
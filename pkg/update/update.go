@@ -4,20 +4,28 @@
 package update
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"slices"
+	"time"
 
 	"github.com/oomol-lab/ovm-win/pkg/ipc/event"
 	"github.com/oomol-lab/ovm-win/pkg/util"
+	"github.com/oomol-lab/ovm-win/pkg/winapi/sys"
 
 	"github.com/oomol-lab/ovm-win/pkg/types"
 )
 
 type Context struct {
 	jsonPath string
+	// current is the versions.json before updating, nil if it is invalid or missing
+	current *Manifest
+	// rootfsSHA256 is the checksum of the new rootfs
+	rootfsSHA256 string
+	// dataMigratedFrom is the data version which the new data is migrated from, empty if the data is created
+	dataMigratedFrom string
 
 	types.Version
 	types.RunOpt
@@ -25,43 +33,108 @@ type Context struct {
 
 func New(opt *types.RunOpt, version types.Version) *Context {
 	return &Context{
-		jsonPath: filepath.Join(opt.ImageDir, "versions.json"),
+		jsonPath: manifestPath(opt.ImageDir),
 		Version:  version,
 		RunOpt:   *opt,
 	}
 }
 
-func (c *Context) save() error {
-	data, err := json.Marshal(c.Version)
-	if err != nil {
-		return fmt.Errorf("failed to marshal versions: %w", err)
+// save records the update in versions.json
+func (c *Context) save(updated []types.VersionKey) error {
+	now := time.Now()
+
+	m := &Manifest{
+		Schema:    ManifestSchema,
+		Version:   c.Version,
+		WrittenBy: util.BinaryVersion(),
+		UpdatedAt: now,
 	}
 
-	if err := os.WriteFile(c.jsonPath, data, 0644); err != nil {
-		return fmt.Errorf("failed to write versions to %s: %w", c.jsonPath, err)
+	entry := HistoryEntry{
+		Time:      now,
+		To:        c.Version,
+		Updated:   updated,
+		WrittenBy: m.WrittenBy,
 	}
 
-	return nil
+	if prev := c.current; prev != nil {
+		m.RootFSInfo = prev.RootFSInfo
+		m.DataInfo = prev.DataInfo
+		m.History = prev.History
+		entry.From = &types.Version{RootFS: prev.RootFS, Data: prev.Data}
+	}
+
+	if slices.Contains(updated, types.VersionRootFS) {
+		m.RootFSInfo = &RootFSRecord{
+			SHA256:     c.rootfsSHA256,
+			Source:     c.RootFSPath,
+			ImportedAt: now,
+		}
+		entry.SHA256 = c.rootfsSHA256
+	}
+
+	if slices.Contains(updated, types.VersionData) {
+		if c.dataMigratedFrom == "" {
+			m.DataInfo = &DataRecord{
+				CreatedAt: now,
+				Size:      util.DataSize(c.Name),
+			}
+		} else {
+			// the disk is the same one, keep its record, a legacy versions.json has no record of it yet
+			info := DataRecord{
+				Size: util.DataSize(c.Name),
+			}
+			if m.DataInfo != nil {
+				info = *m.DataInfo
+			}
+			info.MigratedFrom = c.dataMigratedFrom
+			m.DataInfo = &info
+		}
+	}
+
+	m.History = append(m.History, entry)
+
+	return m.write(c.ImageDir)
 }
 
-func (c *Context) needUpdate() (result []types.VersionKey) {
+var ErrInvalidVersions = errors.New("invalid versions.json")
+
+func (c *Context) needUpdate() (result []types.VersionKey, err error) {
 	log := c.Logger
-	jsonVersion := &types.Version{}
-	data, err := os.ReadFile(c.jsonPath)
+	jsonVersion, legacy, err := ReadManifest(c.ImageDir)
 	if err != nil {
 		log.Warnf("Failed to read versions.json file: %v", err)
-		return []types.VersionKey{types.VersionRootFS, types.VersionData}
+		if errors.Is(err, ErrInvalidVersions) && !c.DataMigrationDryRun {
+			_ = os.RemoveAll(c.jsonPath)
+		}
+		return []types.VersionKey{types.VersionRootFS, types.VersionData}, nil
 	}
+	c.current = jsonVersion
 
-	if err := json.Unmarshal(data, jsonVersion); err != nil {
-		log.Warnf("Failed to unmarshal versions.json file, json content: %s, %v", data, err)
-		_ = os.RemoveAll(c.jsonPath)
-		return []types.VersionKey{types.VersionRootFS, types.VersionData}
+	if legacy && c.DataMigrationDryRun {
+		log.Infof("Dry run: versions.json is not upgraded to schema %d", ManifestSchema)
+	} else if legacy {
+		log.Infof("Upgrading versions.json to schema %d", ManifestSchema)
+		jsonVersion.WrittenBy = util.BinaryVersion()
+		jsonVersion.UpdatedAt = time.Now()
+		if err := jsonVersion.write(c.ImageDir); err != nil {
+			log.Warnf("Failed to upgrade versions.json: %v", err)
+		}
+	}
+
+	rootfsChanged, err := c.versionChanged(types.VersionRootFS, jsonVersion.RootFS, c.RootFS)
+	if err != nil {
+		return nil, err
+	}
+
+	dataChanged, err := c.versionChanged(types.VersionData, jsonVersion.Data, c.Data)
+	if err != nil {
+		return nil, err
 	}
 
 	rootfsPath := filepath.Join(c.ImageDir, "ext4.vhdx")
-	if jsonVersion.RootFS != c.RootFS || util.Exists(rootfsPath) != nil {
-		if jsonVersion.RootFS != c.RootFS {
+	if rootfsChanged || util.Exists(rootfsPath) != nil {
+		if rootfsChanged {
 			log.Infof("Need update rootfs, because version changed: %s -> %s", jsonVersion.RootFS, c.RootFS)
 		} else {
 			log.Infof("Need update rootfs, because rootfs not exists: %s", rootfsPath)
@@ -71,8 +144,8 @@ func (c *Context) needUpdate() (result []types.VersionKey) {
 	}
 
 	dataPath := filepath.Join(c.ImageDir, "data.vhdx")
-	if jsonVersion.Data != c.Data || util.Exists(dataPath) != nil {
-		if jsonVersion.Data != c.Data {
+	if dataChanged || util.Exists(dataPath) != nil {
+		if dataChanged {
 			log.Infof("Need update data, because version changed: %s -> %s", jsonVersion.Data, c.Data)
 		} else {
 			log.Infof("Need update data, because data not exists: %s", dataPath)
@@ -80,20 +153,143 @@ func (c *Context) needUpdate() (result []types.VersionKey) {
 		result = append(result, types.VersionData)
 	}
 
-	return
+	return result, nil
 }
 
+// CheckAndReplace updates the rootfs and data if their versions changed.
+//
+// The new rootfs and data are staged first, the current ones are only replaced after the staging succeeded,
+// and they are kept in the rollback directory until the new version has reached Ready (see [Commit] and [Rollback]).
+//
+// Besides the new rootfs, the update needs free space for about twice the imported rootfs, a copy of the current rootfs,
+// and a copy of the current data when it is migrated, which is checked before anything is changed.
 func (c *Context) CheckAndReplace() error {
 	log := c.Logger
-	list := c.needUpdate()
+
+	// the previous update has never reached Ready, start over from the last working version,
+	// even if the versions are not changed (e.g. the same version is launched again after a failure)
+	if Pending(c.ImageDir) {
+		if c.DataMigrationDryRun {
+			log.Warnf("Dry run: the previous update has not reached ready, it is not rolled back")
+		} else {
+			log.Warnf("The previous update has not reached ready")
+			if err := Rollback(&c.RunOpt); err != nil {
+				return err
+			}
+		}
+	}
+
+	list, err := c.needUpdate()
+	if err != nil {
+		return err
+	}
+
+	updateData := slices.Contains(list, types.VersionData)
+	updateRootFS := slices.Contains(list, types.VersionRootFS)
+
+	// the dry run only copies the data
+	if err := c.checkFreeSpace(updateData, updateRootFS && !c.DataMigrationDryRun); err != nil {
+		return err
+	}
+
+	// a broken rootfs must be refused before the data is migrated
+	if updateRootFS && !c.DataMigrationDryRun {
+		sum, ok := util.Sha256File(c.RootFSPath)
+		if !ok {
+			event.NotifyRun(event.UpdateRootFSFailed)
+			return fmt.Errorf("failed to update rootfs: cannot compute the checksum of %s", c.RootFSPath)
+		}
+		c.rootfsSHA256 = sum
+
+		if err := c.verifyRootFS(); err != nil {
+			event.NotifyRun(event.RootFSInvalid, err.Error())
+			event.NotifyRun(event.UpdateRootFSFailed)
+			return fmt.Errorf("failed to update rootfs: %w", err)
+		}
+	}
+
+	if c.DataMigrationDryRun {
+		return c.dryRun(list)
+	}
+
 	if len(list) == 0 {
 		log.Info("No need to update versions")
 		return nil
 	}
 
-	if slices.Contains(list, types.VersionData) {
+	defer c.removeNext()
+
+	if updateData {
 		event.NotifyRun(event.UpdatingData)
-		if err := c.updateData(); err != nil {
+		if err := c.prepareData(); err != nil {
+			event.NotifyRun(event.UpdateDataFailed)
+			return fmt.Errorf("failed to update data: %w", err)
+		}
+	}
+
+	if updateRootFS {
+		event.NotifyRun(event.UpdatingRootFS)
+		if err := c.stageRootfs(); err != nil {
+			event.NotifyRun(event.UpdateRootFSFailed)
+			return fmt.Errorf("failed to update rootfs: %w", err)
+		}
+	}
+
+	if err := c.replace(updateData, updateRootFS); err != nil {
+		// restore at once, so the user is never left without the distro or the data
+		if err := Rollback(&c.RunOpt); err != nil {
+			log.Warnf("Failed to roll back the failed update: %v", err)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// dryRun plans and tries the data migration on a copy of the data, nothing is changed
+func (c *Context) dryRun(list []types.VersionKey) error {
+	defer c.removeNext()
+
+	if !slices.Contains(list, types.VersionData) {
+		c.Logger.Info("Dry run: no need to update data")
+		return ErrDryRun
+	}
+
+	return c.prepareData()
+}
+
+// replace swaps the staged files in, the current files are moved to the rollback directory
+func (c *Context) replace(updateData, updateRootFS bool) error {
+	log := c.Logger
+	dir := rollbackDir(c.ImageDir)
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create rollback dir: %w", err)
+	}
+
+	if util.Exists(c.jsonPath) == nil {
+		if err := sys.CopyFile(c.jsonPath, filepath.Join(dir, "versions.json"), true); err != nil {
+			return fmt.Errorf("failed to back up versions.json: %w", err)
+		}
+	}
+
+	tx := &transaction{
+		Time: time.Now(),
+	}
+	if err := tx.save(c.ImageDir); err != nil {
+		return err
+	}
+
+	if err := stopDistro(log, c.DistroName); err != nil {
+		return err
+	}
+
+	if updateData {
+		if err := c.backupData(tx); err != nil {
+			event.NotifyRun(event.UpdateDataFailed)
+			return fmt.Errorf("failed to update data: %w", err)
+		}
+		if err := c.swapData(); err != nil {
 			event.NotifyRun(event.UpdateDataFailed)
 			return fmt.Errorf("failed to update data: %w", err)
 		}
@@ -101,9 +297,12 @@ func (c *Context) CheckAndReplace() error {
 		log.Info("Update data success")
 	}
 
-	if slices.Contains(list, types.VersionRootFS) {
-		event.NotifyRun(event.UpdatingRootFS)
-		if err := c.updateRootfs(); err != nil {
+	if updateRootFS {
+		if err := c.backupRootfs(tx); err != nil {
+			event.NotifyRun(event.UpdateRootFSFailed)
+			return fmt.Errorf("failed to update rootfs: %w", err)
+		}
+		if err := c.swapRootfs(); err != nil {
 			event.NotifyRun(event.UpdateRootFSFailed)
 			return fmt.Errorf("failed to update rootfs: %w", err)
 		}
@@ -111,9 +310,28 @@ func (c *Context) CheckAndReplace() error {
 		log.Info("Update rootfs success")
 	}
 
-	if err := c.save(); err != nil {
+	var updated []types.VersionKey
+	if updateRootFS {
+		updated = append(updated, types.VersionRootFS)
+	}
+	if updateData {
+		updated = append(updated, types.VersionData)
+	}
+	if err := c.save(updated); err != nil {
 		return fmt.Errorf("failed to save versions: %w", err)
 	}
 
+	// nothing to roll back on the first installation
+	if !tx.RootFS && !tx.Data {
+		_ = os.RemoveAll(dir)
+	}
+
 	return nil
 }
+
+// removeNext removes the staged files which are not swapped in
+func (c *Context) removeNext() {
+	for _, name := range []string{"ext4.vhdx", "data.vhdx"} {
+		_ = os.RemoveAll(c.nextPath(name))
+	}
+}
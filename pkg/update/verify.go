@@ -0,0 +1,176 @@
+// SPDX-FileCopyrightText: 2025 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package update
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ErrInvalidRootFS means the rootfs archive is corrupted or not the expected one
+var ErrInvalidRootFS = errors.New("invalid rootfs")
+
+var (
+	magicGzip = []byte{0x1f, 0x8b}
+	magicZstd = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// expectedSHA256 returns the expected checksum of the rootfs from --rootfs-sha256 or --rootfs-manifest,
+// empty if neither is specified
+func (c *Context) expectedSHA256() (string, error) {
+	sum := strings.ToLower(strings.TrimSpace(c.RootFSSHA256))
+
+	if c.RootFSManifest != "" {
+		s, err := manifestSHA256(c.RootFSManifest, filepath.Base(c.RootFSPath))
+		if err != nil {
+			return "", err
+		}
+
+		if sum != "" && sum != s {
+			return "", fmt.Errorf("%w: --rootfs-sha256 %s does not match %s in %s", ErrInvalidRootFS, sum, s, c.RootFSManifest)
+		}
+		sum = s
+	}
+
+	return sum, nil
+}
+
+// manifestSHA256 finds the checksum of the file in the manifest, which is in the format of sha256sum:
+//
+//	<sha256>  rootfs.tar.gz
+func manifestSHA256(manifest, name string) (string, error) {
+	f, err := os.Open(manifest)
+	if err != nil {
+		return "", fmt.Errorf("failed to open rootfs manifest: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+
+		// `*` is the binary mode mark of sha256sum
+		if strings.EqualFold(strings.TrimPrefix(fields[1], "*"), name) {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("failed to read rootfs manifest: %w", err)
+	}
+
+	return "", fmt.Errorf("%w: %s is not found in %s", ErrInvalidRootFS, name, manifest)
+}
+
+// verifyRootFS checks the checksum and the structure of the rootfs archive before anything is changed
+func (c *Context) verifyRootFS() error {
+	log := c.Logger
+
+	expected, err := c.expectedSHA256()
+	if err != nil {
+		return err
+	}
+
+	if expected != "" {
+		if expected != c.rootfsSHA256 {
+			return fmt.Errorf("%w: sha256 of %s is %s, expected %s", ErrInvalidRootFS, c.RootFSPath, c.rootfsSHA256, expected)
+		}
+		log.Infof("Rootfs checksum matches: %s", expected)
+	} else {
+		log.Warnf("Rootfs checksum is not specified, skip checking it")
+	}
+
+	if err := checkArchive(c.RootFSPath); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalidRootFS, c.RootFSPath, err)
+	}
+
+	return nil
+}
+
+// checkArchive checks the file is a complete tar, tar.gz or tar.zst, and contains /opt/ovmd
+func checkArchive(p string) error {
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	head, _ := br.Peek(4)
+
+	var r io.Reader = br
+	switch {
+	case bytes.HasPrefix(head, magicZstd):
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return fmt.Errorf("failed to read zstd: %w", err)
+		}
+		defer zr.Close()
+		r = zr
+	case bytes.HasPrefix(head, magicGzip):
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return fmt.Errorf("failed to read gzip: %w", err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	if err := checkTar(r); err != nil {
+		return err
+	}
+
+	// drain the padding after the end of tar, so the checksum of gzip or zstd is verified
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		return fmt.Errorf("failed to read archive: %w", err)
+	}
+
+	return nil
+}
+
+// checkTar reads the whole archive, so a truncated file is detected as well
+func checkTar(r io.Reader) error {
+	tr := tar.NewReader(r)
+	found := false
+
+	for i := 0; ; i++ {
+		h, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			if i == 0 {
+				return errors.New("the archive is empty or not a tar")
+			}
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read tar: %w", err)
+		}
+
+		if path.Clean("/"+h.Name) == "/opt/ovmd" && h.Typeflag != tar.TypeDir {
+			found = true
+		}
+
+		if _, err := io.Copy(io.Discard, tr); err != nil {
+			return fmt.Errorf("failed to read %s in tar: %w", h.Name, err)
+		}
+	}
+
+	if !found {
+		return errors.New("/opt/ovmd is not found in the archive")
+	}
+
+	return nil
+}
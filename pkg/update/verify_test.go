@@ -0,0 +1,110 @@
+// SPDX-FileCopyrightText: 2025 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package update
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// makeTar builds a tar with the files, the content of each file is its name
+func makeTar(t *testing.T, names ...string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, name := range names {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0755, Size: int64(len(name)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func gzipData(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func zstdData(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw, err := zstd.NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(zw, bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestCheckArchive(t *testing.T) {
+	rootfs := makeTar(t, "etc/os-release", "opt/ovmd")
+	noOVMD := makeTar(t, "etc/os-release", "opt/other")
+
+	tests := []struct {
+		name string
+		data []byte
+		ok   bool
+	}{
+		{"tar", rootfs, true},
+		{"tar.gz", gzipData(t, rootfs), true},
+		{"tar.zst", zstdData(t, rootfs), true},
+		{"tar without ovmd", noOVMD, false},
+		{"tar.gz without ovmd", gzipData(t, noOVMD), false},
+		{"tar.zst without ovmd", zstdData(t, noOVMD), false},
+		{"truncated tar", rootfs[:700], false},
+		{"truncated tar.gz", func() []byte { d := gzipData(t, rootfs); return d[:len(d)/2] }(), false},
+		{"truncated tar.zst", func() []byte { d := zstdData(t, rootfs); return d[:len(d)/2] }(), false},
+		{"empty", nil, false},
+		{"not an archive", []byte("hello world"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := filepath.Join(t.TempDir(), "rootfs")
+			if err := os.WriteFile(p, tt.data, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			err := checkArchive(p)
+			if tt.ok && err != nil {
+				t.Errorf("checkArchive() = %v, want nil", err)
+			}
+			if !tt.ok && err == nil {
+				t.Errorf("checkArchive() = nil, want error")
+			}
+		})
+	}
+}
@@ -7,16 +7,10 @@ import (
 	"context"
 	"os/exec"
 	"strings"
-	"syscall"
 
 	"github.com/oomol-lab/ovm-win/pkg/logger"
 )
 
-const (
-	// https://learn.microsoft.com/en-us/windows/win32/procthread/process-creation-flags
-	flagsCreateNoWindow = 0x08000000
-)
-
 func Silent(log *logger.Context, command string, args ...string) error {
 	cmd := SilentCmd(command, args...)
 	cmd.Stdout = nil
@@ -28,20 +22,20 @@ func Silent(log *logger.Context, command string, args ...string) error {
 
 func SilentCmd(command string, args ...string) *exec.Cmd {
 	cmd := exec.Command(command, args...)
-	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: flagsCreateNoWindow}
+	hideWindow(cmd)
 	return cmd
 }
 
 func SilentCmdContext(ctx context.Context, command string, args ...string) *exec.Cmd {
 	cmd := exec.CommandContext(ctx, command, args...)
-	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: flagsCreateNoWindow}
+	hideWindow(cmd)
 	return cmd
 }
 
 func EscapeArg(args []string) string {
 	var newArgs []string
 	for _, arg := range args {
-		newArgs = append(newArgs, syscall.EscapeArg(arg))
+		newArgs = append(newArgs, escapeArg(arg))
 	}
 
 	return strings.Join(newArgs, " ")
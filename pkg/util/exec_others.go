@@ -0,0 +1,17 @@
+// SPDX-FileCopyrightText: 2025 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+//go:build !windows
+
+package util
+
+import (
+	"os/exec"
+	"strconv"
+)
+
+func hideWindow(_ *exec.Cmd) {}
+
+func escapeArg(arg string) string {
+	return strconv.Quote(arg)
+}
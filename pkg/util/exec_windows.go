@@ -0,0 +1,22 @@
+// SPDX-FileCopyrightText: 2025 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package util
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+const (
+	// https://learn.microsoft.com/en-us/windows/win32/procthread/process-creation-flags
+	flagsCreateNoWindow = 0x08000000
+)
+
+func hideWindow(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: flagsCreateNoWindow}
+}
+
+func escapeArg(arg string) string {
+	return syscall.EscapeArg(arg)
+}
@@ -6,7 +6,6 @@ package util
 import (
 	"os"
 
-	"github.com/oomol-lab/ovm-win/pkg/channel"
 	"github.com/oomol-lab/ovm-win/pkg/logger"
 )
 
@@ -20,7 +19,6 @@ func Exit(exitCode int) {
 	for _, f := range list {
 		f()
 	}
-	channel.Close()
 	logger.CloseAll()
 	os.Exit(exitCode)
 }
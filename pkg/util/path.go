@@ -8,8 +8,6 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
-
-	"golang.org/x/sys/windows"
 )
 
 func LocalAppData() (string, bool) {
@@ -29,7 +27,7 @@ func System32Root() (string, bool) {
 		return filepath.Join(p, "System32"), true
 	}
 
-	if p, err := windows.GetSystemDirectory(); err == nil {
+	if p, err := systemDirectory(); err == nil {
 		return p, true
 	}
 
@@ -49,7 +47,7 @@ func CachePath() (string, bool) {
 		return filepath.Join(p, "ovm", "Cache"), true
 	}
 
-	if p, err := windows.KnownFolderPath(windows.FOLDERID_LocalAppData, windows.KF_FLAG_DEFAULT); err == nil {
+	if p, err := localAppDataFolder(); err == nil {
 		return filepath.Join(p, "ovm", "Cache"), true
 	}
 
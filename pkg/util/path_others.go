@@ -0,0 +1,20 @@
+// SPDX-FileCopyrightText: 2025 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+//go:build !windows
+
+package util
+
+import "errors"
+
+// The stubs only keep the package buildable on other platforms for the tests
+
+var errNotWindows = errors.New("only supported on windows")
+
+func systemDirectory() (string, error) {
+	return "", errNotWindows
+}
+
+func localAppDataFolder() (string, error) {
+	return "", errNotWindows
+}
@@ -0,0 +1,14 @@
+// SPDX-FileCopyrightText: 2025 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package util
+
+import "golang.org/x/sys/windows"
+
+func systemDirectory() (string, error) {
+	return windows.GetSystemDirectory()
+}
+
+func localAppDataFolder() (string, error) {
+	return windows.KnownFolderPath(windows.FOLDERID_LocalAppData, windows.KF_FLAG_DEFAULT)
+}
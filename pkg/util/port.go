@@ -9,7 +9,8 @@ import (
 	"strconv"
 )
 
-func portOccupied(port int) error {
+// PortOccupied returns an error if the port cannot be listened on all interfaces
+func PortOccupied(port int) error {
 	ln, err := net.Listen("tcp4", ":"+strconv.Itoa(port))
 	if err != nil {
 		return fmt.Errorf("port %d is occupied, %v", port, err)
@@ -25,7 +26,7 @@ func FindUsablePort(startPort int) (int, error) {
 	var lastErr error
 
 	for port < maxPort {
-		if err := portOccupied(port); err != nil {
+		if err := PortOccupied(port); err != nil {
 			lastErr = err
 		} else {
 			return port, nil
@@ -0,0 +1,32 @@
+// SPDX-FileCopyrightText: 2025 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package util
+
+import (
+	"context"
+	"io"
+	"net"
+)
+
+// Proxy copies the data between the connections in both directions,
+// it returns once both directions are done or the ctx is done, the caller closes the connections.
+func Proxy(ctx context.Context, a, b net.Conn) {
+	done := make(chan struct{}, 2)
+	pipe := func(dst, src net.Conn) {
+		_, _ = io.Copy(dst, src)
+		if c, ok := dst.(interface{ CloseWrite() error }); ok {
+			_ = c.CloseWrite()
+		}
+		done <- struct{}{}
+	}
+
+	go pipe(a, b)
+	go pipe(b, a)
+
+	select {
+	case <-done:
+		<-done
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,51 @@
+// SPDX-FileCopyrightText: 2025 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package util
+
+import (
+	"runtime/debug"
+)
+
+// binaryVersion is set at build time, see Makefile:
+//
+//	-ldflags "-X github.com/oomol-lab/ovm-win/pkg/util.binaryVersion=v1.0.0"
+var binaryVersion string
+
+// BinaryVersion returns the version of ovm-win, the vcs revision is used if the version is not set at build time
+func BinaryVersion() string {
+	if binaryVersion != "" {
+		return binaryVersion
+	}
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+
+	if v := info.Main.Version; v != "" && v != "(devel)" {
+		return v
+	}
+
+	revision, dirty := "", false
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			revision = s.Value
+		case "vcs.modified":
+			dirty = s.Value == "true"
+		}
+	}
+
+	if revision == "" {
+		return "unknown"
+	}
+	if len(revision) > 12 {
+		revision = revision[:12]
+	}
+	if dirty {
+		revision += "-dirty"
+	}
+
+	return revision
+}
@@ -5,6 +5,7 @@ package sys
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/Microsoft/go-winio"
 	"golang.org/x/sys/windows"
@@ -58,3 +59,8 @@ func RunOnce(name, launchPath string) error {
 
 	return nil
 }
+
+// BootTime returns the time when the system was last booted
+func BootTime() time.Time {
+	return time.Now().Add(-windows.DurationSinceBoot())
+}
@@ -13,12 +13,17 @@ import (
 // Although Microsoft claims that version 19041 supports WSL2, it was actually supported in later updates, not right from the start.
 // Version 19043 supports WSL2 from the beginning, but tests show that the latest version of WSL2 has issues when used on 19043.
 // Therefore, for convenience, version 19044 is used here.
-const minBuildNumber uint32 = 19044
+const MinBuildNumber uint32 = 19044
+
+// BuildNumber returns the build number of the current system
+func BuildNumber() uint32 {
+	return windows.RtlGetVersion().BuildNumber
+}
 
 func SupportWSL2(log *logger.Context) bool {
-	v := windows.RtlGetVersion()
+	n := BuildNumber()
 
-	log.Infof("Current system build number is %d", v.BuildNumber)
+	log.Infof("Current system build number is %d", n)
 
-	return v.BuildNumber >= minBuildNumber
+	return n >= MinBuildNumber
 }
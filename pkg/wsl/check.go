@@ -5,80 +5,103 @@ package wsl
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 
 	"github.com/hashicorp/go-version"
-	"github.com/oomol-lab/ovm-win/pkg/channel"
+	"github.com/oomol-lab/ovm-win/pkg/initstate"
 	"github.com/oomol-lab/ovm-win/pkg/ipc/event"
 	"github.com/oomol-lab/ovm-win/pkg/logger"
 	"github.com/oomol-lab/ovm-win/pkg/types"
 	"github.com/oomol-lab/ovm-win/pkg/util"
-	"github.com/oomol-lab/ovm-win/pkg/winapi/sys"
 )
 
-func Check(ctx context.Context, opt *types.InitOpt) {
-	if ok := checkVersion(ctx, opt); !ok {
-		return
+// Check runs the checks of the init stage, it blocks until the checks are passed or the ctx is done.
+//
+// An error is returned only if the init state cannot be moved.
+func Check(ctx context.Context, opt *types.InitOpt) error {
+	if s, ok := opt.State.Resume(); ok {
+		opt.Logger.Infof("Resume init state: %s, system has not been rebooted yet", s)
+		event.NotifyInit(event.NeedReboot)
+
+		<-ctx.Done()
+		return nil
 	}
 
-	if ok := checkFeature(ctx, opt); !ok {
-		return
+	if ok, err := checkVersion(ctx, opt); !ok {
+		return err
+	}
+
+	if ok, err := checkFeature(ctx, opt); !ok {
+		return err
 	}
 
 	if ok := checkBIOS(opt); !ok {
 		opt.Logger.Info("Virtualization is not supported")
+		if err := opt.State.To(initstate.NotSupportVirtualization); err != nil {
+			return err
+		}
 		event.NotifyInit(event.NotSupportVirtualization)
 
 		<-ctx.Done()
-		return
+		return nil
 	}
 
 	// Must be placed last, as this could potentially cause WSL to shut down
-	if ok := checkWSLConfig(ctx, opt); !ok {
-		return
+	if ok, err := checkWSLConfig(ctx, opt); !ok {
+		return err
+	}
+
+	// The state is already Passed if the WSL config has been fixed
+	if err := opt.State.Swap(initstate.Checking, initstate.Passed); err != nil && !errors.Is(err, initstate.ErrStateMismatch) {
+		return err
 	}
 
-	return
+	return nil
 }
 
-func checkFeature(ctx context.Context, opt *types.InitOpt) bool {
+func checkFeature(ctx context.Context, opt *types.InitOpt) (bool, error) {
 	log := opt.Logger
 
 	if isEnabled := isFeatureEnabled(log); isEnabled {
 		log.Info("WSL2 feature is already enabled")
-		return true
+		return true, nil
 	}
 
 	log.Info("WSL2 feature is not enabled")
+	if err := opt.State.To(initstate.NeedEnableFeature); err != nil {
+		return false, err
+	}
 	event.NotifyInit(event.NeedEnableFeature)
-	opt.CanEnableFeature = true
 
 	<-ctx.Done()
-	return false
+	return false, nil
 }
 
-func checkVersion(ctx context.Context, opt *types.InitOpt) bool {
+func checkVersion(ctx context.Context, opt *types.InitOpt) (bool, error) {
 	log := opt.Logger
 
 	if !shouldUpdateWSL(log) {
 		log.Info("WSL2 is up to date")
-		return true
+		return true, nil
 	}
 
+	if err := opt.State.To(initstate.NeedUpdateWSL); err != nil {
+		return false, err
+	}
 	event.NotifyInit(event.NeedUpdateWSL)
-	opt.CanUpdateWSL = true
 
-	select {
-	case <-ctx.Done():
-		log.Warnf("Cancel waiting wsl update, ctx is done: %v", context.Cause(ctx))
-		return false
-	case <-channel.ReceiveWSLUpdated():
-		log.Info("WSL updated")
-		return true
+	// After the WSL is updated, the state goes back to Checking
+	if _, err := opt.State.Wait(ctx, initstate.Checking); err != nil {
+		log.Warnf("Cancel waiting wsl update, ctx is done: %v", err)
+		return false, nil
 	}
+
+	log.Info("WSL updated")
+	return true, nil
 }
 
 func checkBIOS(opt *types.InitOpt) bool {
@@ -116,25 +139,17 @@ func checkBIOS(opt *types.InitOpt) bool {
 	return false
 }
 
-const (
-	FIX_WSLCONFIG_AUTO = iota
-	FIX_WSLCONFIG_OPEN
-	FIX_WSLCONFIG_SKIP
-)
-
 const (
 	skipWslconfigCheckFileSuffix = "_check-wslconfig.skip"
 )
 
-func checkWSLConfig(ctx context.Context, opt *types.InitOpt) bool {
+func checkWSLConfig(ctx context.Context, opt *types.InitOpt) (bool, error) {
 	log := opt.Logger
 
-	if configPath, ok := util.ConfigPath(); ok {
-		skipPath := filepath.Join(configPath, fmt.Sprintf("%s%s", opt.Name, skipWslconfigCheckFileSuffix))
-
-		if ok && util.Exists(skipPath) == nil {
+	if skipPath, ok := skipConfigCheckPath(opt.Name); ok {
+		if util.Exists(skipPath) == nil {
 			log.Info("WSL config check skipped")
-			return true
+			return true, nil
 		}
 	} else {
 		log.Warn("Failed to get OVM config path")
@@ -143,43 +158,47 @@ func checkWSLConfig(ctx context.Context, opt *types.InitOpt) bool {
 	incompatibleKeys := NewConfig(log).ExistIncompatible()
 	if len(incompatibleKeys) == 0 {
 		log.Info("WSL2 config is compatible")
-		return true
+		return true, nil
 	}
 
+	if err := opt.State.To(initstate.WSLConfigIncompatible); err != nil {
+		return false, err
+	}
 	event.NotifyInit(event.WSLConfigMaybeIncompatible, strings.Join(incompatibleKeys, ","))
-	opt.CanFixWSLConfig = true
 
-	select {
-	case <-ctx.Done():
-		log.Warnf("cancel waiting fix wsl config, ctx is done: %v", context.Cause(ctx))
-		return false
-	case flag := <-channel.ReceiveWSLConfigUpdated():
-		log.Info("WSL config updated")
-
-		if flag == FIX_WSLCONFIG_OPEN {
-			<-channel.ReceiveWSLShutdown()
-		}
-
-		return true
+	// If the user chooses to open the WSL config, the state is Passed only after the WSL is shut down
+	if _, err := opt.State.Wait(ctx, initstate.Passed); err != nil {
+		log.Warnf("cancel waiting fix wsl config, ctx is done: %v", err)
+		return false, nil
 	}
+
+	log.Info("WSL config updated")
+	return true, nil
 }
 
 func SkipConfigCheck(opt *types.InitOpt) {
-	configPath, ok := util.ConfigPath()
+	skipPath, ok := skipConfigCheckPath(opt.Name)
 	if !ok {
 		opt.Logger.Warn("Failed to get OVM config path")
 		return
 	}
 
-	skipPath := filepath.Join(configPath, fmt.Sprintf("%s%s", opt.Name, skipWslconfigCheckFileSuffix))
-
 	if err := util.Touch(skipPath); err != nil {
 		opt.Logger.Warnf("Failed to touch skip file: %v", err)
 	}
 }
 
+func skipConfigCheckPath(name string) (string, bool) {
+	configPath, ok := util.ConfigPath()
+	if !ok {
+		return "", false
+	}
+
+	return filepath.Join(configPath, fmt.Sprintf("%s%s", name, skipWslconfigCheckFileSuffix)), true
+}
+
 func recordCPUFeature(log *logger.Context) {
-	vf, slat := sys.IsSupportedVirtualization()
+	vf, slat := isSupportedVirtualization()
 	if !slat {
 		log.Warn("SLAT is not supported")
 	}
@@ -252,7 +271,7 @@ func isFeatureEnabled(log *logger.Context) bool {
 	// in the new version, this behavior has changed;even if the feature is not enabled, there will be no error.
 	//
 	// This command will also have a side effect: it will change the default version of WSL to 2. However, this side effect is expected.
-	if util.Silent(log, Find(), "--set-default-version", "2") != nil {
+	if _, err := wslExec(log, "--set-default-version", "2"); err != nil {
 		return false
 	}
 
@@ -273,31 +292,40 @@ func isFeatureEnabled(log *logger.Context) bool {
 
 		log.Infof("WSL --status result: %s", out)
 
-		lines := strings.Split(string(out), "\n")
-
-		// Delete the line below to avoid inaccuracies in the results.
-		// Default Distribution: Ubuntu
-		// Default Version: 2
-		hasUselessHeader := len(lines) >= 2 && strings.Contains(lines[0], ":") && strings.Contains(lines[1], ":")
-		if hasUselessHeader {
-			log.Info("Exist useless header")
-			lines = lines[2:]
+		if key, found := findStatusKeyword(log, out); found {
+			log.Warnf("Find keyword: %s in status result", key)
+			return false
 		}
-		lineStr := strings.Join(lines, "\n")
+	}
+
+	return true
+}
 
-		log.Infof("Cleaned wsl --status line: %s", lineStr)
+// findStatusKeyword finds the keyword in the `wsl --status` output which indicates the feature is not enabled
+func findStatusKeyword(log *logger.Context, out []byte) (string, bool) {
+	lines := strings.Split(string(out), "\n")
+
+	// Delete the line below to avoid inaccuracies in the results.
+	// Default Distribution: Ubuntu
+	// Default Version: 2
+	hasUselessHeader := len(lines) >= 2 && strings.Contains(lines[0], ":") && strings.Contains(lines[1], ":")
+	if hasUselessHeader {
+		log.Info("Exist useless header")
+		lines = lines[2:]
+	}
+	lineStr := strings.Join(lines, "\n")
 
-		keywords := []string{"Windows Subsystem for Linux", "BIOS", "wsl.exe", "enablevirtualization", "WSL1"}
+	log.Infof("Cleaned wsl --status line: %s", lineStr)
 
-		for _, key := range keywords {
-			if strings.Contains(lineStr, key) {
-				log.Warnf("Find keyword: %s in status result", key)
-				return false
-			}
+	keywords := []string{"Windows Subsystem for Linux", "BIOS", "wsl.exe", "enablevirtualization", "WSL1"}
+
+	for _, key := range keywords {
+		if strings.Contains(lineStr, key) {
+			return key, true
 		}
 	}
 
-	return true
+	return "", false
 }
 
 func wslVersion(log *logger.Context) (string, error) {
@@ -0,0 +1,73 @@
+// SPDX-FileCopyrightText: 2025 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package wsl
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/oomol-lab/ovm-win/pkg/logger"
+)
+
+const dataDiskMountPoint = "/mnt/ovm-data"
+
+// dataDiskScript finds the attached data disk by its sector count (the same way as ovmd), and mounts it
+const dataDiskScript = `set -e
+dev=""
+for b in /sys/block/sd*; do
+  size="$(cat "$b/size")"
+  for s in $OVM_DATA_SECTORS; do
+    if [ "$size" = "$s" ]; then
+      [ -z "$dev" ] || { echo "more than one disk has $size sectors" >&2; exit 1; }
+      dev="/dev/$(basename "$b")"
+    fi
+  done
+done
+[ -n "$dev" ] || { echo "data disk is not found" >&2; exit 1; }
+mkdir -p "$OVM_DATA"
+mount "$dev" "$OVM_DATA"
+trap 'cd /; umount "$OVM_DATA"' EXIT
+cd "$OVM_DATA"
+`
+
+// RunOnDataDisk attaches the data disk, mounts it in the distro and runs the script as root.
+//
+// The mount point is in $OVM_DATA, env is exported to the script as well.
+// sectors are the possible sector counts of the disk, the other disks must not have the same size.
+func RunOnDataDisk(ctx context.Context, log *logger.Context, distroName, vhdxPath string, sectors []uint64, env map[string]string, script string, stdout, stderr io.Writer) error {
+	if err := MountVHDX(log, vhdxPath); err != nil {
+		return fmt.Errorf("failed to attach %s: %w", vhdxPath, err)
+	}
+	defer func() {
+		if err := UmountVHDX(log, vhdxPath); err != nil {
+			log.Warnf("Failed to detach %s: %v", vhdxPath, err)
+		}
+	}()
+
+	s := make([]string, 0, len(sectors))
+	for _, n := range slices.Compact(slices.Clone(sectors)) {
+		s = append(s, strconv.FormatUint(n, 10))
+	}
+
+	var sb strings.Builder
+	_, _ = fmt.Fprintf(&sb, "export OVM_DATA=%s\n", shellQuote(dataDiskMountPoint))
+	_, _ = fmt.Fprintf(&sb, "export OVM_DATA_SECTORS=%s\n", shellQuote(strings.Join(s, " ")))
+	for k, v := range env {
+		_, _ = fmt.Fprintf(&sb, "export %s=%s\n", k, shellQuote(v))
+	}
+	sb.WriteString(dataDiskScript)
+	// run in a subshell, so the trap still unmounts the disk if the script exits
+	_, _ = fmt.Fprintf(&sb, "(\n%s\n)\n", script)
+
+	// the script is sent through stdin, so it is not mangled by the command line of wsl.exe
+	if err := Invoke(ctx, log, distroName, strings.NewReader(sb.String()), stdout, stderr, "-u", "root", "sh", "-s"); err != nil {
+		return fmt.Errorf("failed to run script on data disk: %w", err)
+	}
+
+	return nil
+}
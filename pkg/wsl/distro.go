@@ -9,10 +9,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
-	"time"
+	"sync"
 
 	"github.com/oomol-lab/ovm-win/pkg/ipc/event"
 	"github.com/oomol-lab/ovm-win/pkg/logger"
@@ -50,6 +51,24 @@ func ImportDistro(log *logger.Context, distroName, installPath, rootfs string) e
 	return nil
 }
 
+// ImportDistroInPlace registers the distro with an existing ext4.vhdx, the file is used in place
+func ImportDistroInPlace(log *logger.Context, distroName, vhdxPath string) error {
+	if _, err := wslExec(log, "--import-in-place", distroName, vhdxPath); err != nil {
+		return fmt.Errorf("import distro in place %s failed: %w", vhdxPath, err)
+	}
+
+	return nil
+}
+
+// CheckRootFS checks the distro is able to run and contains /opt/ovmd
+func CheckRootFS(log *logger.Context, distroName string) error {
+	if err := wslInvoke(log, distroName, "test", "-x", "/opt/ovmd"); err != nil {
+		return fmt.Errorf("/opt/ovmd is not found in %s: %w", distroName, err)
+	}
+
+	return nil
+}
+
 func Unregister(log *logger.Context, distroName string) error {
 	if _, err := wslExec(log, "--unregister", distroName); err != nil {
 		return fmt.Errorf("unregister %s failed: %w", distroName, err)
@@ -64,8 +83,7 @@ func IsRegister(log *logger.Context, distroName string) (ok bool, err error) {
 		return false, err
 	}
 
-	_, exists := distros[distroName]
-	return exists, nil
+	return hasDistro(distros, distroName), nil
 }
 
 func IsRunning(log *logger.Context, distroName string) (ok bool, err error) {
@@ -74,8 +92,18 @@ func IsRunning(log *logger.Context, distroName string) (ok bool, err error) {
 		return false, err
 	}
 
-	_, exists := distros[distroName]
-	return exists, nil
+	return hasDistro(distros, distroName), nil
+}
+
+// hasDistro reports whether the distro is in the list, the distro names of WSL are case-insensitive
+func hasDistro(distros map[string]struct{}, distroName string) bool {
+	for name := range distros {
+		if strings.EqualFold(name, distroName) {
+			return true
+		}
+	}
+
+	return false
 }
 
 func SyncDisk(log *logger.Context, distroName string) error {
@@ -109,10 +137,13 @@ func MountVHDX(log *logger.Context, paths ...string) error {
 		if _, err := wslExec(log, "--mount", "--bare", "--vhd", path); err != nil {
 			if strings.Contains(err.Error(), "WSL_E_USER_VHD_ALREADY_ATTACHED") {
 				log.Infof("VHDX already mounted: %s", path)
+				markAttached(path)
 				continue
 			}
 			return fmt.Errorf("wsl mount %s failed: %w", path, err)
 		}
+
+		markAttached(path)
 	}
 
 	return nil
@@ -127,10 +158,13 @@ func UmountVHDX(log *logger.Context, paths ...string) error {
 		if _, err := wslExec(log, "--unmount", path); err != nil {
 			if strings.Contains(err.Error(), "ERROR_FILE_NOT_FOUND") {
 				log.Infof("VHDX already unmounted: %s", path)
+				markDetached(path)
 				continue
 			}
 			return fmt.Errorf("wsl umount %s failed: %w", path, err)
 		}
+
+		markDetached(path)
 	}
 
 	return nil
@@ -152,6 +186,7 @@ func MoveDistro(log *logger.Context, distroName, newPath string) error {
 }
 
 func RequestStop(log *logger.Context, name string) error {
+	markStopping()
 	_ = SyncDisk(log, name)
 
 	if err := wslInvoke(log, name, "/opt/ovmd", "--killall"); err != nil {
@@ -166,6 +201,7 @@ func RequestStop(log *logger.Context, name string) error {
 }
 
 func Stop(log *logger.Context, name string) error {
+	markStopping()
 	_ = SyncDisk(log, name)
 
 	if err := Terminate(log, name); err != nil {
@@ -194,83 +230,115 @@ func Launch(ctx context.Context, log *logger.Context, opt *types.RunOpt) error {
 			log.Info("Distro stopped")
 		})
 
-		return launchOVMD(ctx, opt)
+		return superviseOVMD(ctx, opt)
 	})
 	g.Go(func() error {
-		// TODO: ovmd needs some time to kill the previous podman processes.
-		//   This is just a temporary solution, waiting for ovmd to support sending the ready event.
-		//   @BlackHole1
-		time.Sleep(1 * time.Second)
-		if err := podman.Ready(ctx, opt.PodmanPort); err != nil {
-			return fmt.Errorf("podman is not ready: %w", err)
+		if err := waitOVMDReady(ctx); err != nil {
+			if !errors.Is(err, errNoOVMDPhase) {
+				return err
+			}
+			log.Warnf("ovmd does not report phases, fallback to polling podman")
+
+			if err := waitLegacyOVMD(ctx); err != nil {
+				return err
+			}
+		}
+
+		if err := waitPodman(ctx, opt); err != nil {
+			return err
 		}
 
 		event.NotifyRun(event.Ready)
+		runReadyFuncs()
 		return nil
 	})
 
 	return g.Wait()
 }
 
-func launchOVMD(ctx context.Context, opt *types.RunOpt) error {
-	log := opt.Logger
-	vmLog, err := log.NewWithAppendName("vm")
-	if err != nil {
-		return fmt.Errorf("could not create vm logger: %w", err)
+// waitPodman waits for podman to be ready, and notifies whether podman is unreachable or responds an error if not
+func waitPodman(ctx context.Context, opt *types.RunOpt) error {
+	_, err := podman.Ready(ctx, opt.Logger.Slog(), PodmanDialer(opt), podman.ReadyOpt{
+		Timeout:  opt.PodmanReadyTimeout,
+		Interval: opt.PodmanReadyInterval,
+	})
+	if err == nil {
+		return nil
 	}
 
+	if ctx.Err() == nil {
+		if errors.Is(err, podman.ErrUnreachable) {
+			event.NotifyRun(event.PodmanUnreachable, err.Error())
+		} else {
+			event.NotifyRun(event.PodmanError, err.Error())
+		}
+	}
+
+	return fmt.Errorf("podman is not ready: %w", err)
+}
+
+func launchOVMD(ctx context.Context, opt *types.RunOpt, vmLog *logger.Context) error {
+	log := opt.Logger
+
 	// Backward compatibility
 	oldDataSector := util.DataSize(opt.Name+opt.ImageDir) / 512
 	dataSector := util.DataSize(opt.Name) / 512
 
-	// See: https://github.com/oomol-lab/ovm-builder/blob/main/layers/wsl2_amd64/opt/ovmd
-	cmd := util.SilentCmdContext(ctx, Find(),
-		"-d", opt.DistroName,
-		"/opt/ovmd",
-		"-p", fmt.Sprintf("%d", opt.PodmanPort),
-		"-s", fmt.Sprintf("%d,%d", dataSector, oldDataSector),
-	)
-	cmd.Env = []string{"WSL_UTF8=1"}
-
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return fmt.Errorf("could not get stdout pipe: %w", err)
-	}
-	stderr, err := cmd.StderrPipe()
-	if err != nil {
-		return fmt.Errorf("could not get stderr pipe: %w", err)
+	// podman listens on the TCP port, or only on the guest socket if the TCP listener is disabled (-u)
+	listen := []string{"-p", fmt.Sprintf("%d", opt.PodmanPort)}
+	if !opt.PodmanTCP {
+		listen = []string{"-u", PodmanGuestSocket}
 	}
-	defer func() {
-		_ = stdout.Close()
-		_ = stderr.Close()
-	}()
 
-	log.Infof("Launching %s: podman port is: %d, data sector count: %d", opt.DistroName, opt.PodmanPort, dataSector)
+	// See: https://github.com/oomol-lab/ovm-builder/blob/main/layers/wsl2_amd64/opt/ovmd
+	args := append([]string{"-d", opt.DistroName, "/opt/ovmd"}, listen...)
+	args = append(args, "-s", fmt.Sprintf("%d,%d", dataSector, oldDataSector))
 
-	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("failed to start `%s`: %w", opt.DistroName, err)
-	}
+	stdoutR, stdoutW := io.Pipe()
+	stderrR, stderrW := io.Pipe()
+
+	log.Infof("Launching %s: podman listens on: %s, data sector count: %d", opt.DistroName, strings.Join(listen, " "), dataSector)
 
+	var readers sync.WaitGroup
+	readers.Add(2)
 	go func() {
-		scanner := bufio.NewScanner(stdout)
-		for scanner.Scan() {
-			vmLog.Raw(scanner.Text())
-		}
+		defer readers.Done()
+		scanOVMD(vmLog, stdoutR)
 	}()
 	go func() {
-		scanner := bufio.NewScanner(stderr)
-		for scanner.Scan() {
-			vmLog.Raw(scanner.Text())
-		}
+		defer readers.Done()
+		scanToLog(vmLog, stderrR)
 	}()
 
-	if err := cmd.Wait(); err != nil {
+	markOVMDStarted()
+	err := currentRunner().Run(ctx, args, nil, stdoutW, stderrW)
+	markOVMDExited()
+
+	// The readers stop at EOF, wait for them to consume the rest of the output before closing the read side
+	_ = stdoutW.Close()
+	_ = stderrW.Close()
+	readers.Wait()
+	_ = stdoutR.Close()
+	_ = stderrR.Close()
+
+	if err != nil {
 		return fmt.Errorf("failed to launch ovmd for `%s`: %s", opt.DistroName, err)
 	}
 
 	return fmt.Errorf("ovmd unexpected closed")
 }
 
+func scanToLog(log *logger.Context, r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		markOVMDOutput()
+		log.Raw(scanner.Text())
+	}
+
+	// Keep draining, otherwise the writer side will be blocked forever (e.g. the line is too long)
+	_, _ = io.Copy(io.Discard, r)
+}
+
 // GetAllWSLDistros returns all WSL distros
 func getAllWSLDistros(log *logger.Context, running bool) (map[string]struct{}, error) {
 	args := []string{"--list", "--quiet"}
@@ -306,18 +374,14 @@ func getAllWSLDistros(log *logger.Context, running bool) (map[string]struct{}, e
 }
 
 func wslExec(log *logger.Context, args ...string) ([]byte, error) {
-	cmd := util.SilentCmd(Find(), args...)
 	var stdout bytes.Buffer
 	var stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	cmd.Env = []string{"WSL_UTF8=1"}
 
 	cmdStr := fmt.Sprintf("%s %s", Find(), strings.Join(args, " "))
 
 	log.Infof("Running command in wsl: %s", cmdStr)
 
-	if err := cmd.Run(); err != nil {
+	if err := currentRunner().Run(context.Background(), args, nil, &stdout, &stderr); err != nil {
 		return nil, fmt.Errorf("failed to run command `%s` failed: %s %s (%w)", cmdStr, stderr.String(), stdout.String(), err)
 	}
 
@@ -327,18 +391,14 @@ func wslExec(log *logger.Context, args ...string) ([]byte, error) {
 func wslInvoke(log *logger.Context, name string, args ...string) error {
 	newArgs := []string{"-d", name}
 	newArgs = append(newArgs, args...)
-	cmd := util.SilentCmd(Find(), newArgs...)
 	var stdout bytes.Buffer
 	var stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	cmd.Env = []string{"WSL_UTF8=1"}
 
 	cmdStr := fmt.Sprintf("%s %s", Find(), strings.Join(newArgs, " "))
 
 	log.Infof("Running command in distro: %s", cmdStr)
 
-	if err := cmd.Run(); err != nil {
+	if err := currentRunner().Run(context.Background(), newArgs, nil, &stdout, &stderr); err != nil {
 		return fmt.Errorf("failed to run command `%s` in distro: %s %s (%w)", cmdStr, stderr.String(), stdout.String(), err)
 	}
 
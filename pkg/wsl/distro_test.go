@@ -0,0 +1,159 @@
+// SPDX-FileCopyrightText: 2025 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package wsl
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/oomol-lab/ovm-win/pkg/logger"
+	"github.com/oomol-lab/ovm-win/pkg/types"
+	"github.com/oomol-lab/ovm-win/pkg/wsl/wslfake"
+)
+
+func newTestLogger(t *testing.T) *logger.Context {
+	t.Helper()
+
+	log, err := logger.New(t.TempDir(), "test")
+	if err != nil {
+		t.Fatalf("failed to create logger: %v", err)
+	}
+	t.Cleanup(logger.CloseAll)
+
+	return log
+}
+
+func useFake(t *testing.T) *wslfake.Runner {
+	t.Helper()
+
+	f := wslfake.New()
+	prev := SetRunner(f)
+	t.Cleanup(func() {
+		SetRunner(prev)
+	})
+
+	return f
+}
+
+func TestMountVHDX(t *testing.T) {
+	tests := []struct {
+		name    string
+		resp    wslfake.Response
+		wantErr bool
+	}{
+		{"attached", wslfake.OK(""), false},
+		{"already attached", wslfake.VHDAlreadyAttached(), false},
+		{"hyper-v not installed", wslfake.HyperVNotInstalled(), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := useFake(t)
+			f.On("--mount", "--bare", "--vhd").Return(tt.resp)
+
+			p := `C:\ovm\data.vhdx`
+			err := MountVHDX(newTestLogger(t), p)
+			defer markDetached(p)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("MountVHDX() error = %v, wantErr %t", err, tt.wantErr)
+			}
+
+			attached := false
+			for _, d := range AttachedDisks() {
+				attached = attached || strings.EqualFold(d, p)
+			}
+			if attached == tt.wantErr {
+				t.Errorf("disk attached = %t, want %t", attached, !tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMoveDistro(t *testing.T) {
+	tests := []struct {
+		name string
+		resp wslfake.Response
+		want error
+	}{
+		{"moved", wslfake.OK(""), nil},
+		{"sharing violation", wslfake.SharingViolation(), ErrSharingViolation},
+		{"distro not stopped", wslfake.DistroNotStopped(), ErrSharingViolation},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := useFake(t)
+			f.On("--manage", "ovm-test", "--move").Return(tt.resp)
+
+			err := MoveDistro(newTestLogger(t), "ovm-test", `D:\ovm`)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("MoveDistro() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsRegister(t *testing.T) {
+	f := useFake(t)
+	f.On("--list", "--quiet", "--all").Return(wslfake.OK("Ubuntu\r\novm-test\r\n"))
+	log := newTestLogger(t)
+
+	for name, want := range map[string]bool{"ovm-test": true, "OVM-Test": true, "ubuntu": true, "Debian": false} {
+		ok, err := IsRegister(log, name)
+		if err != nil {
+			t.Fatalf("IsRegister(%q) error = %v", name, err)
+		}
+		if ok != want {
+			t.Errorf("IsRegister(%q) = %t, want %t", name, ok, want)
+		}
+	}
+}
+
+func TestLaunchOVMDKeepsOutput(t *testing.T) {
+	f := useFake(t)
+	f.On("-d", "ovm-test", "/opt/ovmd").Return(wslfake.Response{
+		Stdout:   strings.Repeat("starting podman\n", 1000) + "last line of ovmd\n",
+		Stderr:   "last line of stderr\n",
+		ExitCode: 1,
+	})
+
+	dir := t.TempDir()
+	log, err := logger.New(dir, "test")
+	if err != nil {
+		t.Fatalf("failed to create logger: %v", err)
+	}
+	t.Cleanup(logger.CloseAll)
+	vmLog, err := log.NewWithAppendName("vm")
+	if err != nil {
+		t.Fatalf("failed to create vm logger: %v", err)
+	}
+
+	opt := &types.RunOpt{
+		DistroName: "ovm-test",
+		PodmanPort: 5432,
+		BasicOpt: types.BasicOpt{
+			Name:   "test",
+			Logger: log,
+		},
+	}
+	if err := launchOVMD(context.Background(), opt, vmLog); err == nil {
+		t.Fatal("launchOVMD() should fail when ovmd exits")
+	}
+
+	// every line must be written once launchOVMD returns
+	data, err := os.ReadFile(filepath.Join(dir, "test-vm.log"))
+	if err != nil {
+		t.Fatalf("failed to read vm log: %v", err)
+	}
+	for _, line := range []string{"last line of ovmd", "last line of stderr"} {
+		if !strings.Contains(string(data), line) {
+			t.Errorf("vm log does not contain %q", line)
+		}
+	}
+}
@@ -0,0 +1,304 @@
+// SPDX-FileCopyrightText: 2025 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package wsl
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-version"
+	"github.com/oomol-lab/ovm-win/pkg/logger"
+	"github.com/oomol-lab/ovm-win/pkg/types"
+	"github.com/oomol-lab/ovm-win/pkg/util"
+)
+
+type CheckStatus string
+
+const (
+	CheckPass CheckStatus = "pass"
+	CheckWarn CheckStatus = "warn"
+	CheckFail CheckStatus = "fail"
+)
+
+// CheckResult is the result of one check in the doctor report
+type CheckResult struct {
+	Name        string         `json:"name"`
+	Status      CheckStatus    `json:"status"`
+	Message     string         `json:"message"`
+	Evidence    map[string]any `json:"evidence,omitempty"`
+	Remediation string         `json:"remediation,omitempty"`
+}
+
+// Report is the result of [Doctor]
+type Report struct {
+	Name   string        `json:"name"`
+	Time   time.Time     `json:"time"`
+	OK     bool          `json:"ok"`
+	Checks []CheckResult `json:"checks"`
+}
+
+// Doctor runs all the checks of the init stage without any interaction and side effect.
+//
+// Unlike [Check], it never blocks and never notifies events, the results are only returned in the report.
+// No distro is booted unless opt.ProbeDistro is set.
+func Doctor(opt *types.DoctorOpt) *Report {
+	log := opt.Logger
+	r := &Report{
+		Name: opt.Name,
+		Time: time.Now(),
+		OK:   true,
+	}
+
+	for _, check := range []func(*types.DoctorOpt) CheckResult{
+		doctorSystem,
+		doctorVersion,
+		doctorFeature,
+		doctorVirtualization,
+		doctorWSLConfig,
+	} {
+		result := check(opt)
+		log.Infof("Doctor check %s: %s, %s", result.Name, result.Status, result.Message)
+
+		if result.Status == CheckFail {
+			r.OK = false
+		}
+		r.Checks = append(r.Checks, result)
+	}
+
+	return r
+}
+
+func doctorSystem(_ *types.DoctorOpt) CheckResult {
+	n, minBuild := buildNumber()
+	r := CheckResult{
+		Name: "system",
+		Evidence: map[string]any{
+			"buildNumber":    n,
+			"minBuildNumber": minBuild,
+		},
+	}
+
+	if n < minBuild {
+		r.Status = CheckFail
+		r.Message = fmt.Sprintf("Windows build %d does not support WSL2", n)
+		r.Remediation = fmt.Sprintf("Upgrade Windows to build %d (Windows 10 21H2) or later", minBuild)
+		return r
+	}
+
+	r.Status = CheckPass
+	r.Message = fmt.Sprintf("Windows build %d supports WSL2", n)
+	return r
+}
+
+func doctorVersion(opt *types.DoctorOpt) CheckResult {
+	log := opt.Logger
+	r := CheckResult{
+		Name: "version",
+		Evidence: map[string]any{
+			"minVersion": minVersion,
+		},
+		Remediation: fmt.Sprintf("Update WSL to %s or later with `wsl --update`, or run `ovm init` to install it", minVersion),
+	}
+
+	if !isInstalled(log) {
+		r.Status = CheckFail
+		r.Message = "WSL2 is not installed or too old to report its version"
+		return r
+	}
+
+	if out, err := wslExec(log, "--version"); err == nil {
+		r.Evidence["wslVersion"] = parseKeyValues(out)
+	}
+
+	v, err := wslVersion(log)
+	if err != nil {
+		r.Status = CheckFail
+		r.Message = fmt.Sprintf("Failed to get WSL2 version: %v", err)
+		return r
+	}
+	r.Evidence["version"] = v
+
+	currentVersion, err := version.NewVersion(v)
+	if err != nil {
+		r.Status = CheckFail
+		r.Message = fmt.Sprintf("Failed to parse WSL2 version %s: %v", v, err)
+		return r
+	}
+
+	if currentVersion.LessThan(version.Must(version.NewVersion(minVersion))) {
+		r.Status = CheckFail
+		r.Message = fmt.Sprintf("WSL2 version %s is less than %s", v, minVersion)
+		return r
+	}
+
+	r.Status = CheckPass
+	r.Message = fmt.Sprintf("WSL2 version %s is up to date", v)
+	r.Remediation = ""
+	return r
+}
+
+func doctorFeature(opt *types.DoctorOpt) CheckResult {
+	log := opt.Logger
+	r := CheckResult{
+		Name:        "feature",
+		Evidence:    map[string]any{},
+		Remediation: "Enable the Microsoft-Windows-Subsystem-Linux and VirtualMachinePlatform features (run `ovm init`), then reboot",
+	}
+
+	out, err := wslExec(log, "--status")
+	if err != nil {
+		r.Evidence["error"] = err.Error()
+
+		if strings.Contains(err.Error(), "--install --no-distribution") {
+			r.Status = CheckFail
+			r.Message = "WSL2 feature is not enabled"
+			return r
+		}
+
+		r.Status = CheckWarn
+		r.Message = "Failed to get WSL status, cannot determine whether the feature is enabled"
+		return r
+	}
+
+	r.Evidence["status"] = parseKeyValues(out)
+
+	if key, found := findStatusKeyword(log, out); found {
+		r.Evidence["keyword"] = key
+		r.Status = CheckFail
+		r.Message = fmt.Sprintf("WSL status reports %q, the feature may not be enabled", key)
+		return r
+	}
+
+	r.Status = CheckPass
+	r.Message = "WSL2 feature is enabled"
+	r.Remediation = ""
+	return r
+}
+
+func doctorVirtualization(opt *types.DoctorOpt) CheckResult {
+	log := opt.Logger
+	vf, slat := isSupportedVirtualization()
+	r := CheckResult{
+		Name: "virtualization",
+		Evidence: map[string]any{
+			"vtx":  vf,
+			"slat": slat,
+		},
+		Remediation: "Enable virtualization (Intel VT-x / AMD-V) in the BIOS/UEFI settings",
+	}
+
+	// Invoking a distro boots the utility VM, so it is only done when asked
+	if opt.ProbeDistro {
+		if done := probeDistro(log, &r); done {
+			return r
+		}
+	}
+
+	if !vf || !slat {
+		r.Status = CheckWarn
+		r.Message = "CPU does not report VT-x or SLAT, virtualization may not be supported"
+		return r
+	}
+
+	r.Status = CheckPass
+	r.Message = "CPU supports VT-x and SLAT"
+	r.Remediation = ""
+	return r
+}
+
+// probeDistro invokes the first distro to check virtualization, done is true if the result is decided
+func probeDistro(log *logger.Context, r *CheckResult) (done bool) {
+	list, err := getAllWSLDistros(log, false)
+	if err != nil || len(list) == 0 {
+		return false
+	}
+
+	var first string
+	for key := range list {
+		first = key
+		break
+	}
+
+	flag := "TEST_PASS"
+
+	var out string
+	_ = Exec(log).SetAllOut(&out).SetDistro(first).Run("echo", flag)
+	r.Evidence["probeDistro"] = first
+
+	if strings.Contains(out, flag) {
+		r.Status = CheckPass
+		r.Message = fmt.Sprintf("Distro %s can be invoked, virtualization is supported", first)
+		r.Remediation = ""
+		return true
+	}
+
+	if strings.Contains(out, "HCS_E_HYPERV_NOT_INSTALLED") {
+		r.Evidence["probeOutput"] = strings.TrimSpace(out)
+		r.Status = CheckFail
+		r.Message = "Hyper-V is not available, BIOS does not support virtualization"
+		return true
+	}
+
+	return false
+}
+
+func doctorWSLConfig(opt *types.DoctorOpt) CheckResult {
+	log := opt.Logger
+	keys := NewConfig(log).ExistIncompatible()
+	r := CheckResult{
+		Name: "wslconfig",
+		Evidence: map[string]any{
+			"incompatibleKeys": keys,
+		},
+	}
+
+	if p, ok := skipConfigCheckPath(opt.Name); ok && util.Exists(p) == nil {
+		r.Evidence["skipped"] = true
+	}
+
+	if len(keys) == 0 {
+		r.Status = CheckPass
+		r.Message = "WSL2 config is compatible"
+		return r
+	}
+
+	r.Status = CheckWarn
+	r.Message = fmt.Sprintf("WSL2 config may be incompatible: %s", strings.Join(keys, ","))
+	if p, ok := NewConfig(log).path(); ok {
+		r.Remediation = fmt.Sprintf("Comment out %s in %s, then run `wsl --shutdown`", strings.Join(keys, ", "), p)
+	}
+	return r
+}
+
+// parseKeyValues parses the `key: value` lines in the wsl output, other lines are collected in the `lines`
+//
+// e.g. `wsl --version` output:
+//
+//	WSL version: 2.3.24.0
+//	Kernel version: 5.15.153.1-2
+func parseKeyValues(out []byte) map[string]any {
+	r := map[string]any{}
+	var lines []string
+
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		if k, v, found := strings.Cut(line, ":"); found && !strings.HasPrefix(v, "//") && strings.TrimSpace(v) != "" {
+			r[strings.TrimSpace(k)] = strings.TrimSpace(v)
+			continue
+		}
+
+		lines = append(lines, line)
+	}
+
+	if len(lines) != 0 {
+		r["lines"] = lines
+	}
+
+	return r
+}
@@ -5,11 +5,11 @@ package wsl
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"strings"
 
 	"github.com/oomol-lab/ovm-win/pkg/logger"
-	"github.com/oomol-lab/ovm-win/pkg/util"
 )
 
 type ExecContext struct {
@@ -60,18 +60,14 @@ func (c *ExecContext) Run(args ...string) error {
 	}
 	newArgs = append(newArgs, args...)
 
-	cmd := util.SilentCmd(Find(), newArgs...)
 	var stdout bytes.Buffer
 	var stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	cmd.Env = []string{"WSL_UTF8=1"}
 
 	cmdStr := fmt.Sprintf("%s %s", Find(), strings.Join(newArgs, " "))
 
 	c.log.Infof("Running wsl command: %s", cmdStr)
 
-	err := cmd.Run()
+	err := currentRunner().Run(context.Background(), newArgs, nil, &stdout, &stderr)
 
 	if c.stdout != nil {
 		*c.stdout = stdout.String()
@@ -0,0 +1,188 @@
+// SPDX-FileCopyrightText: 2025 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package wsl
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/oomol-lab/ovm-win/pkg/logger"
+)
+
+var (
+	ErrFileNotFound = errors.New("file not found")
+	ErrFileExists   = errors.New("file already exists")
+	// ErrGNUTarRequired means the tar in the distro cannot keep the existing files (such as the busybox one)
+	ErrGNUTarRequired = errors.New("GNU tar is required in the distro to keep the existing files, or overwrite them")
+)
+
+// exit codes of the file scripts, to distinguish the well-known failures from the others
+const (
+	exitFileNotFound = 44
+	exitFileExists   = 45
+	exitNoGNUTar     = 46
+)
+
+// FileInfo is the file info in the distro
+type FileInfo struct {
+	Path  string
+	IsDir bool
+	Size  int64
+	Mode  os.FileMode
+}
+
+// WriteFileOpt is the options of [WriteFile]
+type WriteFileOpt struct {
+	// Path is the absolute path in the distro, it is the directory to extract to if Tar is true
+	Path string
+	// Mode is the permission of the file, default 0644. It is ignored if Tar is true (the archive has its own)
+	Mode os.FileMode
+	// Overwrite replaces the existing file, otherwise [ErrFileExists] is returned (or the existing files are kept if Tar is true)
+	Overwrite bool
+	// Tar extracts the content as a tar archive
+	Tar bool
+}
+
+func checkDistroPath(p string) error {
+	if !path.IsAbs(p) {
+		return fmt.Errorf("path must be absolute: %q", p)
+	}
+
+	return nil
+}
+
+// runFileScript runs the script and maps the well-known exit codes to errors
+func runFileScript(ctx context.Context, log *logger.Context, distroName, script string, stdin io.Reader, stdout io.Writer) error {
+	var stderr bytes.Buffer
+	// stdin carries the file content, so the script is passed with --exec to skip the login shell of the distro,
+	// which would expand "$tmp" and the other variables before our sh sees them
+	err := Invoke(ctx, log, distroName, stdin, stdout, &stderr, "--exec", "sh", "-c", script)
+	if err == nil {
+		return nil
+	}
+
+	code, _ := ExitCode(err)
+	switch code {
+	case exitFileNotFound:
+		return ErrFileNotFound
+	case exitFileExists:
+		return ErrFileExists
+	case exitNoGNUTar:
+		return ErrGNUTarRequired
+	}
+
+	return fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+}
+
+// StatFile returns the file info in the distro
+func StatFile(ctx context.Context, log *logger.Context, distroName, p string) (*FileInfo, error) {
+	if err := checkDistroPath(p); err != nil {
+		return nil, err
+	}
+
+	q := shellQuote(p)
+	s := fmt.Sprintf("[ -e %s ] || exit %d; stat -L -c '%%F|%%s|%%a' -- %s", q, exitFileNotFound, q)
+
+	var stdout bytes.Buffer
+	if err := runFileScript(ctx, log, distroName, s, nil, &stdout); err != nil {
+		if errors.Is(err, ErrFileNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to stat %s: %w", p, err)
+	}
+
+	fields := strings.Split(strings.TrimSpace(stdout.String()), "|")
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("unexpected stat output of %s: %q", p, stdout.String())
+	}
+
+	size, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse size of %s: %w", p, err)
+	}
+
+	mode, err := strconv.ParseUint(fields[2], 8, 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse mode of %s: %w", p, err)
+	}
+
+	return &FileInfo{
+		Path:  p,
+		IsDir: fields[0] == "directory",
+		Size:  size,
+		Mode:  os.FileMode(mode),
+	}, nil
+}
+
+// ReadFile writes the file content to w, or a tar archive of the directory content if the path is a directory
+func ReadFile(ctx context.Context, log *logger.Context, distroName string, info *FileInfo, w io.Writer) error {
+	q := shellQuote(info.Path)
+
+	s := fmt.Sprintf("[ -e %s ] || exit %d; cat -- %s", q, exitFileNotFound, q)
+	if info.IsDir {
+		s = fmt.Sprintf("[ -d %s ] || exit %d; tar -cf - -C %s .", q, exitFileNotFound, q)
+	}
+
+	if err := runFileScript(ctx, log, distroName, s, nil, w); err != nil {
+		if errors.Is(err, ErrFileNotFound) {
+			return err
+		}
+		return fmt.Errorf("failed to read %s: %w", info.Path, err)
+	}
+
+	return nil
+}
+
+// WriteFile writes the content of r to the path in the distro.
+//
+// The file is written to a temporary file first and renamed, so the existing file is not broken on failure.
+func WriteFile(ctx context.Context, log *logger.Context, distroName string, opt *WriteFileOpt, r io.Reader) error {
+	if err := checkDistroPath(opt.Path); err != nil {
+		return err
+	}
+
+	q := shellQuote(opt.Path)
+
+	var s string
+	if opt.Tar {
+		s = fmt.Sprintf("mkdir -p %s && tar -xf - -C %s", q, q)
+		if !opt.Overwrite {
+			// -k fails on every existing file, --skip-old-files keeps them silently, but only GNU tar has it
+			s = fmt.Sprintf("tar --version 2>/dev/null | grep -q 'GNU tar' || exit %d\n", exitNoGNUTar) +
+				fmt.Sprintf("mkdir -p %s && tar -xf - --skip-old-files -C %s", q, q)
+		}
+	} else {
+		mode := opt.Mode
+		if mode == 0 {
+			mode = 0o644
+		}
+
+		var lines []string
+		if !opt.Overwrite {
+			lines = append(lines, fmt.Sprintf("[ -e %s ] && exit %d", q, exitFileExists))
+		}
+		lines = append(lines,
+			fmt.Sprintf("mkdir -p %s || exit 1", shellQuote(path.Dir(opt.Path))),
+			fmt.Sprintf("tmp=%s", shellQuote(opt.Path+".ovm-upload")),
+			fmt.Sprintf(`cat > "$tmp" && chmod %o "$tmp" && mv -f "$tmp" %s || { rm -f "$tmp"; exit 1; }`, mode.Perm(), q),
+		)
+		s = strings.Join(lines, "\n")
+	}
+
+	if err := runFileScript(ctx, log, distroName, s, r, nil); err != nil {
+		if errors.Is(err, ErrFileExists) {
+			return err
+		}
+		return fmt.Errorf("failed to write %s: %w", opt.Path, err)
+	}
+
+	return nil
+}
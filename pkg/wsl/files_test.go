@@ -0,0 +1,49 @@
+// SPDX-FileCopyrightText: 2025 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package wsl
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/oomol-lab/ovm-win/pkg/wsl/wslfake"
+)
+
+func TestWriteFileTar(t *testing.T) {
+	tests := []struct {
+		name      string
+		overwrite bool
+		resp      wslfake.Response
+		wantErr   error
+		wantCheck bool
+	}{
+		{"keep existing files with GNU tar", false, wslfake.OK(""), nil, true},
+		{"keep existing files without GNU tar", false, wslfake.Response{ExitCode: exitNoGNUTar}, ErrGNUTarRequired, true},
+		{"overwrite with any tar", true, wslfake.OK(""), nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := useFake(t)
+			f.On("-d", "ovm-test", "--exec", "sh", "-c").Return(tt.resp)
+
+			opt := &WriteFileOpt{Path: "/root/dir", Tar: true, Overwrite: tt.overwrite}
+			err := WriteFile(context.Background(), newTestLogger(t), "ovm-test", opt, strings.NewReader(""))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("WriteFile() error = %v, want %v", err, tt.wantErr)
+			}
+
+			calls := f.Calls()
+			if len(calls) != 1 {
+				t.Fatalf("wsl.exe is called %d times, want 1", len(calls))
+			}
+			script := calls[0][len(calls[0])-1]
+			if got := strings.Contains(script, "GNU tar"); got != tt.wantCheck {
+				t.Errorf("script checks GNU tar = %t, want %t: %s", got, tt.wantCheck, script)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+// SPDX-FileCopyrightText: 2025 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package wsl
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/oomol-lab/ovm-win/pkg/logger"
+)
+
+var (
+	guestMux sync.Mutex
+	_guestIP string
+)
+
+// GuestIP returns the IP address of the distro, which is reachable from the host
+func GuestIP(log *logger.Context, name string) (string, error) {
+	guestMux.Lock()
+	defer guestMux.Unlock()
+
+	if _guestIP != "" {
+		return _guestIP, nil
+	}
+
+	ip, err := getGuestIP(log, name)
+	if err != nil {
+		return "", err
+	}
+
+	_guestIP = ip
+	log.Infof("Guest IP is: %s", _guestIP)
+
+	return _guestIP, nil
+}
+
+func resetGuestIP() {
+	guestMux.Lock()
+	defer guestMux.Unlock()
+
+	_guestIP = ""
+}
+
+func getGuestIP(log *logger.Context, name string) (string, error) {
+	var out string
+	if err := Exec(log).SetDistro(name).SetStdout(&out).Run("ip", "-4", "route", "get", "1"); err != nil {
+		return "", fmt.Errorf("failed to get guest ip: %w", err)
+	}
+
+	// e.g. 1.0.0.0 via 172.22.16.1 dev eth0 src 172.22.22.206 uid 0
+	arr := strings.Fields(out)
+	for i := 0; i < len(arr)-1; i++ {
+		if arr[i] == "src" {
+			return arr[i+1], nil
+		}
+	}
+
+	return "", fmt.Errorf("failed to parse guest ip from output: %s", out)
+}
+
+// DialGuest connects to the TCP port in the distro
+func DialGuest(ctx context.Context, log *logger.Context, name string, port int) (net.Conn, error) {
+	ip, err := GuestIP(log, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(ip, strconv.Itoa(port)))
+	if err == nil {
+		return conn, nil
+	}
+
+	// the IP address may be changed after the distro restarted
+	resetGuestIP()
+	newIP, ipErr := GuestIP(log, name)
+	if ipErr != nil || newIP == ip {
+		return nil, err
+	}
+
+	return d.DialContext(ctx, "tcp", net.JoinHostPort(newIP, strconv.Itoa(port)))
+}
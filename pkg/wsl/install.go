@@ -13,12 +13,12 @@ import (
 	"path/filepath"
 	"time"
 
+	"github.com/oomol-lab/ovm-win/pkg/initstate"
 	"github.com/oomol-lab/ovm-win/pkg/ipc/event"
 	"github.com/oomol-lab/ovm-win/pkg/logger"
 	"github.com/oomol-lab/ovm-win/pkg/types"
 	"github.com/oomol-lab/ovm-win/pkg/util"
 	"github.com/oomol-lab/ovm-win/pkg/util/request"
-	"github.com/oomol-lab/ovm-win/pkg/winapi/sys"
 )
 
 // Install installs WSL2 feature
@@ -30,16 +30,18 @@ func Install(opt *types.InitOpt) error {
 		event.NotifyInit(event.EnableFeaturing)
 	}
 
-	if !sys.IsAdmin() {
+	if !isAdmin() {
 		log.Info("Current process is not running with admin privileges, will open a new process with admin privileges")
-		if err := sys.ReRunAsAdminWait(); err != nil {
+		if err := reRunAsAdminWait(); err != nil {
+			moveState(opt, initstate.NeedEnableFeature)
 			event.NotifyInit(event.EnableFeatureFailed)
 			return fmt.Errorf("failed to run as admin: %w", err)
 		}
 
 		log.Info("Admin process already successfully executed and exited")
-		opt.CanEnableFeature = false
-		opt.CanReboot = true
+		if err := opt.State.To(initstate.NeedReboot); err != nil {
+			return err
+		}
 		event.NotifyInit(event.EnableFeatureSuccess)
 		event.NotifyInit(event.NeedReboot)
 		return nil
@@ -54,6 +56,7 @@ func Install(opt *types.InitOpt) error {
 			util.Exit(1)
 		}
 
+		moveState(opt, initstate.NeedEnableFeature)
 		event.NotifyInit(event.EnableFeatureFailed)
 		return wrapperErr
 	}
@@ -64,13 +67,21 @@ func Install(opt *types.InitOpt) error {
 		util.Exit(0)
 	}
 
-	opt.CanEnableFeature = false
-	opt.CanReboot = true
+	if err := opt.State.To(initstate.NeedReboot); err != nil {
+		return err
+	}
 	event.NotifyInit(event.EnableFeatureSuccess)
 	event.NotifyInit(event.NeedReboot)
 	return nil
 }
 
+// moveState moves the init state on the failure path, the error is only logged so the original failure is returned
+func moveState(opt *types.InitOpt, to initstate.State) {
+	if err := opt.State.To(to); err != nil {
+		opt.Logger.Warnf("Failed to move init state: %v", err)
+	}
+}
+
 func doEnableFeature(opt *types.InitOpt) error {
 	log := opt.Logger
 	logPath, err := logger.NewOnlyCreate(opt.LogPath, opt.Name+"-dism")
@@ -110,10 +121,24 @@ const latestURL = "https://static.oomol.com/wsl-msi/latest.json"
 
 // Update updates WSL2(include kernel)
 func Update(opt *types.InitOpt) error {
-	log := opt.Logger
-
 	event.NotifyInit(event.UpdatingWSL)
 
+	if err := doUpdate(opt); err != nil {
+		moveState(opt, initstate.NeedUpdateWSL)
+		event.NotifyInit(event.UpdateWSLFailed)
+		return err
+	}
+
+	if err := opt.State.To(initstate.Checking); err != nil {
+		return err
+	}
+	event.NotifyInit(event.UpdateWSLSuccess)
+	return nil
+}
+
+func doUpdate(opt *types.InitOpt) error {
+	log := opt.Logger
+
 	log.Info("Downloading the latest version of WSL2...")
 
 	ctx := context.WithValue(context.Background(), request.NoCache, true)
@@ -123,13 +148,11 @@ func Update(opt *types.InitOpt) error {
 
 	body, err := request.Get(ctx, latestURL)
 	if err != nil {
-		event.NotifyInit(event.UpdateWSLFailed)
 		return fmt.Errorf("failed to get latest version: %w", err)
 	}
 
 	var l latest
 	if err := json.Unmarshal(body, &l); err != nil {
-		event.NotifyInit(event.UpdateWSLFailed)
 		return fmt.Errorf("failed to unmarshal latest version: %w", err)
 	}
 
@@ -137,18 +160,15 @@ func Update(opt *types.InitOpt) error {
 
 	cachePath, ok := util.CachePath()
 	if !ok {
-		event.NotifyInit(event.UpdateWSLFailed)
 		return fmt.Errorf("failed to get cache path")
 	}
 	if err := os.MkdirAll(cachePath, 0755); err != nil {
-		event.NotifyInit(event.UpdateWSLFailed)
 		return fmt.Errorf("failed to create cache path: %w", err)
 	}
 
 	msi := filepath.Join(cachePath, "wsl2.msi")
 
 	if err := request.Download(context.Background(), log, l.X64.URL, msi, l.X64.Sha256); err != nil {
-		event.NotifyInit(event.UpdateWSLFailed)
 		return fmt.Errorf("failed to download WSL2: %w", err)
 	}
 
@@ -157,13 +177,10 @@ func Update(opt *types.InitOpt) error {
 		return fmt.Errorf("failed to create logger in update wsl: %w", err)
 	}
 
-	if err := sys.RunAsAdminWait([]string{"msiexec", "/i", msi, "/passive", "/norestart", "/L*V", logPath}, opt.LogPath); err != nil {
-		event.NotifyInit(event.UpdateWSLFailed)
+	if err := runAsAdminWait([]string{"msiexec", "/i", msi, "/passive", "/norestart", "/L*V", logPath}, opt.LogPath); err != nil {
 		return fmt.Errorf("failed to update WSL2: %w", err)
 	}
 
-	opt.CanUpdateWSL = false
-	event.NotifyInit(event.UpdateWSLSuccess)
 	return nil
 }
 
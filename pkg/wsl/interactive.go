@@ -0,0 +1,190 @@
+// SPDX-FileCopyrightText: 2025 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package wsl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/oomol-lab/ovm-win/pkg/logger"
+)
+
+// Invoke runs the command in the distro with the given stdio, and waits for it to exit
+func Invoke(ctx context.Context, log *logger.Context, distroName string, stdin io.Reader, stdout, stderr io.Writer, args ...string) error {
+	newArgs := []string{"-d", distroName}
+	newArgs = append(newArgs, args...)
+
+	log.Infof("Invoking command in distro: %s %s", Find(), strings.Join(newArgs, " "))
+
+	return currentRunner().Run(ctx, newArgs, stdin, stdout, stderr)
+}
+
+// ExitCode returns the exit code in the error returned by [Invoke], ok is false if the command did not exit normally
+func ExitCode(err error) (code int, ok bool) {
+	if err == nil {
+		return 0, true
+	}
+
+	var eerr interface{ ExitCode() int }
+	if errors.As(err, &eerr) && eerr.ExitCode() >= 0 {
+		return eerr.ExitCode(), true
+	}
+
+	return 0, false
+}
+
+// InteractiveOpt is the options of an interactive command
+type InteractiveOpt struct {
+	// ID identifies the command, it is used to locate the pid and tty in the distro
+	ID      string
+	Command string
+	Env     map[string]string
+	Cwd     string
+	// TTY allocates a pseudo terminal in the distro (through `script`)
+	TTY  bool
+	Rows int
+	Cols int
+}
+
+var envKeyRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// signals are the signals that can be forwarded to the interactive command
+var signals = []string{"HUP", "INT", "QUIT", "KILL", "USR1", "USR2", "TERM", "CONT", "STOP", "TSTP", "WINCH"}
+
+func (o *InteractiveOpt) pidFile() string {
+	return fmt.Sprintf("/tmp/ovm-exec-%s.pid", o.ID)
+}
+
+func (o *InteractiveOpt) ttyFile() string {
+	return fmt.Sprintf("/tmp/ovm-exec-%s.tty", o.ID)
+}
+
+func (o *InteractiveOpt) script() (string, error) {
+	var lines []string
+
+	if o.TTY {
+		lines = append(lines, fmt.Sprintf("tty > %s", o.ttyFile()))
+		if o.Rows > 0 && o.Cols > 0 {
+			lines = append(lines, fmt.Sprintf("stty rows %d cols %d", o.Rows, o.Cols))
+		}
+	}
+
+	lines = append(lines, fmt.Sprintf("echo $$ > %s", o.pidFile()))
+
+	if o.Cwd != "" {
+		lines = append(lines, fmt.Sprintf("cd %s || exit 1", shellQuote(o.Cwd)))
+	}
+
+	cmd := []string{"exec", "env"}
+	for k, v := range o.Env {
+		if !envKeyRegexp.MatchString(k) {
+			return "", fmt.Errorf("invalid environment variable name: %q", k)
+		}
+		cmd = append(cmd, shellQuote(k+"="+v))
+	}
+	cmd = append(cmd, "sh", "-c", shellQuote(o.Command))
+	lines = append(lines, strings.Join(cmd, " "))
+
+	s := strings.Join(lines, "\n")
+	if !o.TTY {
+		return s, nil
+	}
+
+	// `script` allocates the pseudo terminal, -e returns the exit code of the child process
+	return fmt.Sprintf("exec script -qfec %s /dev/null", shellQuote(s)), nil
+}
+
+// ErrTTYUnsupported means the distro cannot allocate a pseudo terminal for the interactive command
+var ErrTTYUnsupported = errors.New("pseudo terminal is not supported in the distro, `script` of util-linux is required")
+
+// ttySupported is the distros which have passed [CheckTTY]
+var ttySupported sync.Map
+
+// CheckTTY makes sure `script` of util-linux (which supports -e) exists in the distro, it is required by the TTY mode.
+//
+// The busybox `script` does not know --version, so it fails the check as well.
+func CheckTTY(log *logger.Context, distroName string) error {
+	if _, ok := ttySupported.Load(distroName); ok {
+		return nil
+	}
+
+	s := `script --version 2>/dev/null | grep -q util-linux`
+	if err := wslInvoke(log, distroName, "--exec", "sh", "-c", s); err != nil {
+		log.Warnf("Failed to find script of util-linux in %s: %v", distroName, err)
+		return ErrTTYUnsupported
+	}
+
+	ttySupported.Store(distroName, struct{}{})
+	return nil
+}
+
+// Interactive runs the command in the distro with stdin, and returns the exit code of the command
+func Interactive(ctx context.Context, log *logger.Context, distroName string, opt *InteractiveOpt, stdin io.Reader, stdout, stderr io.Writer) (int, error) {
+	if opt.TTY {
+		if err := CheckTTY(log, distroName); err != nil {
+			return 0, err
+		}
+	}
+
+	s, err := opt.script()
+	if err != nil {
+		return 0, err
+	}
+
+	defer func() {
+		if err := wslInvoke(log, distroName, "rm", "-f", opt.pidFile(), opt.ttyFile()); err != nil {
+			log.Warnf("Failed to clean interactive command %s: %v", opt.ID, err)
+		}
+	}()
+
+	// stdin belongs to the command, so the script is passed with --exec to skip the login shell of the distro,
+	// which would expand $$ and the other variables before our sh sees them
+	err = Invoke(ctx, log, distroName, stdin, stdout, stderr, "--exec", "sh", "-c", s)
+	if code, ok := ExitCode(err); ok {
+		return code, nil
+	}
+
+	return 0, fmt.Errorf("failed to run interactive command %s: %w", opt.ID, err)
+}
+
+// ResizeInteractive resizes the pseudo terminal of the interactive command
+func ResizeInteractive(log *logger.Context, distroName, id string, rows, cols int) error {
+	if rows <= 0 || cols <= 0 {
+		return fmt.Errorf("invalid terminal size: %dx%d", rows, cols)
+	}
+
+	opt := &InteractiveOpt{ID: id}
+	s := fmt.Sprintf(`t=$(cat %s) && stty -F "$t" rows %d cols %d && pkill -WINCH -t "${t#/dev/}"`, opt.ttyFile(), rows, cols)
+	if err := wslInvoke(log, distroName, "--exec", "sh", "-c", s); err != nil {
+		return fmt.Errorf("failed to resize terminal of %s: %w", id, err)
+	}
+
+	return nil
+}
+
+// SignalInteractive sends the signal (such as INT, TERM) to the interactive command
+func SignalInteractive(log *logger.Context, distroName, id, signal string) error {
+	signal = strings.TrimPrefix(strings.ToUpper(signal), "SIG")
+	if !slices.Contains(signals, signal) {
+		return fmt.Errorf("unsupported signal: %s", signal)
+	}
+
+	opt := &InteractiveOpt{ID: id}
+	s := fmt.Sprintf(`kill -s %s "$(cat %s)"`, signal, opt.pidFile())
+	if err := wslInvoke(log, distroName, "--exec", "sh", "-c", s); err != nil {
+		return fmt.Errorf("failed to send signal %s to %s: %w", signal, id, err)
+	}
+
+	return nil
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
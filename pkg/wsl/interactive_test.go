@@ -0,0 +1,45 @@
+// SPDX-FileCopyrightText: 2025 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package wsl
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/oomol-lab/ovm-win/pkg/wsl/wslfake"
+)
+
+func TestCheckTTY(t *testing.T) {
+	tests := []struct {
+		name    string
+		distro  string
+		resp    wslfake.Response
+		wantErr error
+	}{
+		{"util-linux script", "ovm-tty-ok", wslfake.OK(""), nil},
+		{"missing or busybox script", "ovm-tty-missing", wslfake.Response{ExitCode: 1}, ErrTTYUnsupported},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := useFake(t)
+			f.On("-d", tt.distro, "--exec", "sh", "-c").Return(tt.resp)
+
+			if err := CheckTTY(newTestLogger(t), tt.distro); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("CheckTTY() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestInteractiveWithoutScript(t *testing.T) {
+	f := useFake(t)
+	f.On("-d", "ovm-no-script", "--exec", "sh", "-c").Return(wslfake.Response{ExitCode: 1})
+
+	opt := &InteractiveOpt{ID: "1", Command: "sh -l", TTY: true}
+	if _, err := Interactive(context.Background(), newTestLogger(t), "ovm-no-script", opt, nil, nil, nil); !errors.Is(err, ErrTTYUnsupported) {
+		t.Fatalf("Interactive() error = %v, want %v", err, ErrTTYUnsupported)
+	}
+}
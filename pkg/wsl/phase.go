@@ -0,0 +1,159 @@
+// SPDX-FileCopyrightText: 2025 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package wsl
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/oomol-lab/ovm-win/pkg/ipc/event"
+	"github.com/oomol-lab/ovm-win/pkg/logger"
+)
+
+// OVMDPhase is the status marker printed by ovmd to stdout as a JSON line, e.g.:
+//
+//	{"phase":"podman-starting","progress":60,"message":"starting podman service"}
+//
+// ovmd prints the `ready` phase once podman is able to serve requests.
+type OVMDPhase struct {
+	Phase    string `json:"phase"`
+	Progress int    `json:"progress,omitempty"`
+	Message  string `json:"message,omitempty"`
+}
+
+const PhaseReady = "ready"
+
+// legacyOVMDTimeout is how long to wait for the first status marker after ovmd printed its first line,
+// the ovmd that prints no marker in this period is considered not supporting the markers
+const legacyOVMDTimeout = 3 * time.Second
+
+// legacyOVMDStaleDelay is how long the legacy ovmd needs to kill the previous podman processes,
+// probing podman earlier may hit the stale podman socket
+const legacyOVMDStaleDelay = 1 * time.Second
+
+var errNoOVMDPhase = errors.New("ovmd does not report phases")
+
+var (
+	phase       OVMDPhase
+	phaseSeen   bool
+	outputSeen  bool
+	phaseChange = make(chan struct{})
+)
+
+// parseOVMDPhase parses the status marker, ok is false if the line is a normal log
+func parseOVMDPhase(line string) (p OVMDPhase, ok bool) {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "{") {
+		return p, false
+	}
+
+	if err := json.Unmarshal([]byte(line), &p); err != nil || p.Phase == "" {
+		return p, false
+	}
+
+	return p, true
+}
+
+func setOVMDPhase(p OVMDPhase) {
+	statusMux.Lock()
+	defer statusMux.Unlock()
+
+	phase = p
+	phaseSeen = phaseSeen || p.Phase != ""
+	ovmd.Phase = p.Phase
+	ovmd.Progress = p.Progress
+
+	close(phaseChange)
+	phaseChange = make(chan struct{})
+}
+
+// markOVMDOutput records that ovmd has printed something, which means the distro has booted
+func markOVMDOutput() {
+	statusMux.Lock()
+	defer statusMux.Unlock()
+
+	if outputSeen {
+		return
+	}
+
+	outputSeen = true
+	close(phaseChange)
+	phaseChange = make(chan struct{})
+}
+
+// resetOVMDPhase clears the phase of the previous ovmd before it is launched again
+func resetOVMDPhase() {
+	statusMux.Lock()
+	outputSeen = false
+	statusMux.Unlock()
+
+	setOVMDPhase(OVMDPhase{})
+}
+
+// waitOVMDReady waits for ovmd to report the ready phase.
+//
+// It returns errNoOVMDPhase if ovmd has never reported any phase in legacyOVMDTimeout since its first output,
+// the timer does not start before that, because booting the distro may take much longer.
+func waitOVMDReady(ctx context.Context) error {
+	var legacy <-chan time.Time
+
+	for {
+		statusMux.Lock()
+		p, seen, output, ch := phase, phaseSeen, outputSeen, phaseChange
+		statusMux.Unlock()
+
+		if p.Phase == PhaseReady {
+			return nil
+		}
+
+		if output && legacy == nil {
+			legacy = time.After(legacyOVMDTimeout)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ch:
+		case <-legacy:
+			if !seen {
+				return errNoOVMDPhase
+			}
+		}
+	}
+}
+
+// waitLegacyOVMD waits for the legacy ovmd (without status markers) to clean up the previous podman
+func waitLegacyOVMD(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(legacyOVMDStaleDelay):
+		return nil
+	}
+}
+
+// scanOVMD writes the ovmd output to the log, and forwards the status markers as run events
+func scanOVMD(log *logger.Context, r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		markOVMDOutput()
+		log.Raw(line)
+
+		if p, ok := parseOVMDPhase(line); ok {
+			setOVMDPhase(p)
+
+			data, _ := json.Marshal(&p)
+			event.NotifyRun(event.Progress, string(data))
+		}
+	}
+
+	// Keep draining, otherwise the writer side will be blocked forever (e.g. the line is too long)
+	_, _ = io.Copy(io.Discard, r)
+}
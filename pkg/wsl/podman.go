@@ -0,0 +1,117 @@
+// SPDX-FileCopyrightText: 2025 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package wsl
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/oomol-lab/ovm-win/pkg/logger"
+	"github.com/oomol-lab/ovm-win/pkg/podman"
+	"github.com/oomol-lab/ovm-win/pkg/types"
+)
+
+// PodmanGuestSocket is the podman API socket in the distro when the TCP listener is disabled.
+//
+// Unlike a TCP port, a unix socket is never forwarded to the host by WSL, it is only reachable through wsl.exe.
+const PodmanGuestSocket = "/run/ovm/podman.sock"
+
+// PodmanDialer returns the dialer of the podman API: 127.0.0.1:PodmanPort (forwarded by WSL),
+// or the guest socket bridged by `podman system dial-stdio` if the TCP listener is disabled
+func PodmanDialer(opt *types.RunOpt) podman.Dialer {
+	if opt.PodmanTCP {
+		return podman.TCPDialer(opt.PodmanPort)
+	}
+
+	return func(ctx context.Context) (net.Conn, error) {
+		return dialStdio(ctx, opt.Logger, opt.DistroName,
+			"podman", "--url", "unix://"+PodmanGuestSocket, "system", "dial-stdio")
+	}
+}
+
+// dialStdio runs the command in the distro, and uses its stdin and stdout as the connection.
+//
+// The command lives as long as the connection, it is not bound to ctx, which is only used for dialing.
+func dialStdio(ctx context.Context, log *logger.Context, distroName string, args ...string) (net.Conn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// files instead of io.Pipe, so the command uses them directly, and exits with stdin being closed
+	stdinR, stdinW, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stdin pipe: %w", err)
+	}
+	stdoutR, stdoutW, err := os.Pipe()
+	if err != nil {
+		_ = stdinR.Close()
+		_ = stdinW.Close()
+		return nil, fmt.Errorf("failed to create stdout pipe: %w", err)
+	}
+
+	runCtx, cancel := context.WithCancel(context.Background())
+	c := &stdioConn{
+		r:      stdoutR,
+		w:      stdinW,
+		cancel: cancel,
+	}
+
+	newArgs := append([]string{"-d", distroName, "--exec"}, args...)
+	go func() {
+		var stderr bytes.Buffer
+		if err := currentRunner().Run(runCtx, newArgs, stdinR, stdoutW, &stderr); err != nil && runCtx.Err() == nil {
+			log.Warnf("Command %s in distro exited: %v %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+		}
+
+		// the reader gets EOF once the command exits
+		_ = stdinR.Close()
+		_ = stdoutW.Close()
+	}()
+
+	return c, nil
+}
+
+// stdioConn is the connection over the stdin and stdout of a command
+type stdioConn struct {
+	r      *os.File
+	w      *os.File
+	cancel context.CancelFunc
+}
+
+type stdioAddr struct{}
+
+func (stdioAddr) Network() string { return "stdio" }
+func (stdioAddr) String() string  { return "stdio" }
+
+func (c *stdioConn) Read(b []byte) (int, error)  { return c.r.Read(b) }
+func (c *stdioConn) Write(b []byte) (int, error) { return c.w.Write(b) }
+
+// CloseWrite closes stdin, the command sees EOF and can still send the rest of its output
+func (c *stdioConn) CloseWrite() error {
+	return c.w.Close()
+}
+
+func (c *stdioConn) Close() error {
+	_ = c.w.Close()
+	c.cancel()
+	return c.r.Close()
+}
+
+func (c *stdioConn) LocalAddr() net.Addr  { return stdioAddr{} }
+func (c *stdioConn) RemoteAddr() net.Addr { return stdioAddr{} }
+
+func (c *stdioConn) SetDeadline(t time.Time) error {
+	if err := c.r.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.w.SetWriteDeadline(t)
+}
+
+func (c *stdioConn) SetReadDeadline(t time.Time) error  { return c.r.SetReadDeadline(t) }
+func (c *stdioConn) SetWriteDeadline(t time.Time) error { return c.w.SetWriteDeadline(t) }
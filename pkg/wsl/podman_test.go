@@ -0,0 +1,74 @@
+// SPDX-FileCopyrightText: 2025 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package wsl
+
+import (
+	"context"
+	"io"
+	"slices"
+	"testing"
+
+	"github.com/oomol-lab/ovm-win/pkg/types"
+	"github.com/oomol-lab/ovm-win/pkg/wsl/wslfake"
+)
+
+func TestLaunchOVMDListen(t *testing.T) {
+	tests := []struct {
+		name string
+		tcp  bool
+		want []string
+	}{
+		{"tcp", true, []string{"-p", "5432"}},
+		{"guest socket only", false, []string{"-u", PodmanGuestSocket}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := useFake(t)
+			f.On("-d", "ovm-test", "/opt/ovmd").Return(wslfake.OK(""))
+
+			log := newTestLogger(t)
+			opt := &types.RunOpt{
+				DistroName: "ovm-test",
+				PodmanPort: 5432,
+				PodmanTCP:  tt.tcp,
+				BasicOpt:   types.BasicOpt{Name: "test", Logger: log},
+			}
+			_ = launchOVMD(context.Background(), opt, log)
+
+			calls := f.Calls()
+			if len(calls) != 1 {
+				t.Fatalf("wsl.exe is called %d times, want 1", len(calls))
+			}
+			if !slices.Equal(calls[0][3:5], tt.want) {
+				t.Errorf("ovmd args = %v, want %v after /opt/ovmd", calls[0], tt.want)
+			}
+		})
+	}
+}
+
+func TestPodmanDialerGuestSocket(t *testing.T) {
+	f := useFake(t)
+	f.On("-d", "ovm-test", "--exec", "podman", "--url", "unix://"+PodmanGuestSocket, "system", "dial-stdio").Return(wslfake.OK("pong"))
+
+	opt := &types.RunOpt{
+		DistroName: "ovm-test",
+		BasicOpt:   types.BasicOpt{Logger: newTestLogger(t)},
+	}
+
+	conn, err := PodmanDialer(opt)(context.Background())
+	if err != nil {
+		t.Fatalf("dial error = %v", err)
+	}
+	defer conn.Close()
+
+	// the reader gets the output of the command, then EOF once it exits
+	data, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("read error = %v", err)
+	}
+	if string(data) != "pong" {
+		t.Errorf("read %q, want %q", data, "pong")
+	}
+}
@@ -0,0 +1,54 @@
+// SPDX-FileCopyrightText: 2025 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package wsl
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/oomol-lab/ovm-win/pkg/util"
+)
+
+// Runner runs wsl.exe with the given args and waits for it to exit.
+//
+// All wsl.exe invocations in this package go through the current Runner,
+// so it can be replaced (see [SetRunner]) to simulate wsl.exe, e.g. with the fake in pkg/wsl/wslfake.
+type Runner interface {
+	Run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) error
+}
+
+type execRunner struct{}
+
+func (execRunner) Run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	cmd := util.SilentCmdContext(ctx, Find(), args...)
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.Env = []string{"WSL_UTF8=1"}
+
+	return cmd.Run()
+}
+
+var (
+	runnerMux sync.RWMutex
+	runner    Runner = execRunner{}
+)
+
+// SetRunner replaces the Runner used by this package and returns the previous one
+func SetRunner(r Runner) Runner {
+	runnerMux.Lock()
+	defer runnerMux.Unlock()
+
+	prev := runner
+	runner = r
+	return prev
+}
+
+func currentRunner() Runner {
+	runnerMux.RLock()
+	defer runnerMux.RUnlock()
+
+	return runner
+}
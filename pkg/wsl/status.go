@@ -0,0 +1,134 @@
+// SPDX-FileCopyrightText: 2025 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package wsl
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oomol-lab/ovm-win/pkg/logger"
+)
+
+// OVMDStatus is the runtime status of `/opt/ovmd` in the current process
+type OVMDStatus struct {
+	Running   bool      `json:"running"`
+	StartedAt time.Time `json:"startedAt"`
+	Restarts  int       `json:"restarts"`
+	// Phase and Progress are the last status marker reported by ovmd
+	Phase    string `json:"phase,omitempty"`
+	Progress int    `json:"progress,omitempty"`
+}
+
+var (
+	statusMux sync.Mutex
+	ovmd      OVMDStatus
+	launches  int
+	attached  []string
+	stopping  bool
+	vmLog     *logger.Context
+
+	readyFuncs []func()
+)
+
+// OVMD returns the runtime status of ovmd
+func OVMD() OVMDStatus {
+	statusMux.Lock()
+	defer statusMux.Unlock()
+
+	return ovmd
+}
+
+// AttachedDisks returns the disks attached to WSL by the current process
+func AttachedDisks() []string {
+	statusMux.Lock()
+	defer statusMux.Unlock()
+
+	return slices.Clone(attached)
+}
+
+// VMLog returns the logger of the ovmd output, nil if ovmd has not been launched
+func VMLog() *logger.Context {
+	statusMux.Lock()
+	defer statusMux.Unlock()
+
+	return vmLog
+}
+
+func setVMLog(log *logger.Context) {
+	statusMux.Lock()
+	defer statusMux.Unlock()
+
+	vmLog = log
+}
+
+// RegisterReadyFunc registers f to be called once the distro is ready for the first time
+func RegisterReadyFunc(f func()) {
+	statusMux.Lock()
+	defer statusMux.Unlock()
+
+	readyFuncs = append(readyFuncs, f)
+}
+
+func runReadyFuncs() {
+	statusMux.Lock()
+	fs := readyFuncs
+	readyFuncs = nil
+	statusMux.Unlock()
+
+	for _, f := range fs {
+		f()
+	}
+}
+
+func markOVMDStarted() {
+	statusMux.Lock()
+	defer statusMux.Unlock()
+
+	launches++
+	ovmd = OVMDStatus{
+		Running:   true,
+		StartedAt: time.Now(),
+		Restarts:  launches - 1,
+	}
+}
+
+func markOVMDExited() {
+	statusMux.Lock()
+	defer statusMux.Unlock()
+
+	ovmd.Running = false
+}
+
+func markAttached(path string) {
+	statusMux.Lock()
+	defer statusMux.Unlock()
+
+	if !slices.ContainsFunc(attached, func(p string) bool { return strings.EqualFold(p, path) }) {
+		attached = append(attached, path)
+	}
+}
+
+func markDetached(path string) {
+	statusMux.Lock()
+	defer statusMux.Unlock()
+
+	attached = slices.DeleteFunc(attached, func(p string) bool { return strings.EqualFold(p, path) })
+}
+
+// markStopping marks the distro is being stopped on purpose, so ovmd exit is expected
+func markStopping() {
+	statusMux.Lock()
+	defer statusMux.Unlock()
+
+	stopping = true
+}
+
+func isStopping() bool {
+	statusMux.Lock()
+	defer statusMux.Unlock()
+
+	return stopping
+}
@@ -0,0 +1,101 @@
+// SPDX-FileCopyrightText: 2025 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package wsl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/oomol-lab/ovm-win/pkg/ipc/event"
+	"github.com/oomol-lab/ovm-win/pkg/types"
+)
+
+const (
+	restartInitialBackoff = 1 * time.Second
+	restartMaxBackoff     = 30 * time.Second
+
+	// If ovmd has been running for this long, the previous crashes are forgiven
+	restartStableDuration = 5 * time.Minute
+)
+
+// superviseOVMD launches ovmd and restarts it with exponential backoff when it exits unexpectedly.
+//
+// It gives up after ovmd has crashed more than opt.OVMDMaxRestarts times in a row.
+func superviseOVMD(ctx context.Context, opt *types.RunOpt) error {
+	log := opt.Logger
+	vmLog, err := log.NewWithAppendName("vm")
+	if err != nil {
+		return fmt.Errorf("could not create vm logger: %w", err)
+	}
+	setVMLog(vmLog)
+
+	restarts := 0
+	backoff := restartInitialBackoff
+
+	for {
+		launchCtx, cancel := context.WithCancel(ctx)
+		resetOVMDPhase()
+		if restarts != 0 {
+			go waitRecovered(launchCtx, opt, restarts)
+		}
+
+		startedAt := time.Now()
+		err := launchOVMD(launchCtx, opt, vmLog)
+		cancel()
+
+		if ctx.Err() != nil || isStopping() {
+			return err
+		}
+
+		if time.Since(startedAt) >= restartStableDuration {
+			restarts = 0
+			backoff = restartInitialBackoff
+		}
+
+		if opt.OVMDMaxRestarts == 0 {
+			return err
+		}
+
+		if restarts >= opt.OVMDMaxRestarts {
+			event.NotifyRun(event.GaveUp, err.Error())
+			return fmt.Errorf("give up restarting ovmd after %d restarts: %w", restarts, err)
+		}
+
+		restarts++
+		log.Warnf("ovmd exited unexpectedly: %v, restart %d/%d after %s", err, restarts, opt.OVMDMaxRestarts, backoff)
+		event.NotifyRun(event.Restarting, fmt.Sprintf("%d", restarts))
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+
+		backoff = min(backoff*2, restartMaxBackoff)
+	}
+}
+
+func waitRecovered(ctx context.Context, opt *types.RunOpt, restarts int) {
+	if err := waitOVMDReady(ctx); err != nil {
+		if !errors.Is(err, errNoOVMDPhase) {
+			return
+		}
+
+		if err := waitLegacyOVMD(ctx); err != nil {
+			return
+		}
+	}
+
+	if err := waitPodman(ctx, opt); err != nil {
+		if ctx.Err() == nil {
+			opt.Logger.Warnf("Podman is not ready after restart %d: %v", restarts, err)
+		}
+		return
+	}
+
+	opt.Logger.Infof("ovmd recovered after restart %d", restarts)
+	event.NotifyRun(event.Recovered)
+}
@@ -0,0 +1,32 @@
+// SPDX-FileCopyrightText: 2025 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+//go:build !windows
+
+package wsl
+
+import "errors"
+
+// The stubs only keep the package buildable on other platforms, so it can be tested with wslfake
+
+var errNotWindows = errors.New("only supported on windows")
+
+func buildNumber() (n, minBuild uint32) {
+	return 0, 0
+}
+
+func isSupportedVirtualization() (vf, slat bool) {
+	return true, true
+}
+
+func isAdmin() bool {
+	return false
+}
+
+func reRunAsAdminWait() error {
+	return errNotWindows
+}
+
+func runAsAdminWait(_ []string, _ string) error {
+	return errNotWindows
+}
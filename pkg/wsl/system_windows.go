@@ -0,0 +1,27 @@
+// SPDX-FileCopyrightText: 2025 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+package wsl
+
+import "github.com/oomol-lab/ovm-win/pkg/winapi/sys"
+
+// buildNumber returns the build number of Windows and the minimum one which supports WSL2
+func buildNumber() (n, minBuild uint32) {
+	return sys.BuildNumber(), sys.MinBuildNumber
+}
+
+func isSupportedVirtualization() (vf, slat bool) {
+	return sys.IsSupportedVirtualization()
+}
+
+func isAdmin() bool {
+	return sys.IsAdmin()
+}
+
+func reRunAsAdminWait() error {
+	return sys.ReRunAsAdminWait()
+}
+
+func runAsAdminWait(cmd []string, cwd string) error {
+	return sys.RunAsAdminWait(cmd, cwd)
+}
@@ -0,0 +1,231 @@
+// SPDX-FileCopyrightText: 2025 OOMOL, Inc. <https://www.oomol.com>
+// SPDX-License-Identifier: MPL-2.0
+
+// Package wslfake provides a scriptable wsl.Runner that replays recorded wsl.exe output.
+//
+// It has no Windows dependencies, so the logic built on top of wsl.exe can be exercised anywhere:
+//
+//	f := wslfake.New()
+//	f.On("--mount", "--bare", "--vhd").Return(wslfake.VHDAlreadyAttached())
+//	f.On("--manage").Return(wslfake.SharingViolation(), wslfake.OK(""))
+//	prev := wsl.SetRunner(f)
+//	defer wsl.SetRunner(prev)
+package wslfake
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// failureExitCode wsl.exe exits with 0xFFFFFFFF when the operation failed
+const failureExitCode = -1
+
+// Response is a recorded wsl.exe result
+type Response struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+
+	// Block keeps the command running until the context is done, such as `/opt/ovmd`
+	Block bool
+}
+
+// ExitError is returned by [Runner.Run] when the response has a non-zero exit code
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+func (e *ExitError) ExitCode() int {
+	return e.Code
+}
+
+// Rule replays the responses for commands starting with args
+type Rule struct {
+	args      []string
+	responses []Response
+	hits      int
+}
+
+// Return sets the responses, they are replayed in order and the last one is repeated
+func (r *Rule) Return(responses ...Response) *Rule {
+	r.responses = responses
+	return r
+}
+
+type Runner struct {
+	mu    sync.Mutex
+	rules []*Rule
+	calls [][]string
+}
+
+func New() *Runner {
+	return &Runner{}
+}
+
+// On registers a rule for commands starting with args.
+//
+// When several rules match, the one with the longest args wins, and among those the latest registered.
+func (f *Runner) On(args ...string) *Rule {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	r := &Rule{
+		args: args,
+	}
+	f.rules = append(f.rules, r)
+	return r
+}
+
+// Calls returns the args of every command run so far
+func (f *Runner) Calls() [][]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return slices.Clone(f.calls)
+}
+
+// Called reports whether a command starting with args has been run
+func (f *Runner) Called(args ...string) bool {
+	for _, c := range f.Calls() {
+		if hasPrefix(c, args) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (f *Runner) Run(ctx context.Context, args []string, _ io.Reader, stdout, stderr io.Writer) error {
+	resp, ok := f.next(args)
+	if !ok {
+		return fmt.Errorf("wslfake: no response recorded for `wsl %s`", strings.Join(args, " "))
+	}
+
+	if stdout != nil && resp.Stdout != "" {
+		_, _ = io.WriteString(stdout, resp.Stdout)
+	}
+	if stderr != nil && resp.Stderr != "" {
+		_, _ = io.WriteString(stderr, resp.Stderr)
+	}
+
+	if resp.Block {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	if resp.ExitCode != 0 {
+		return &ExitError{Code: resp.ExitCode}
+	}
+
+	return nil
+}
+
+func (f *Runner) next(args []string) (Response, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls = append(f.calls, slices.Clone(args))
+
+	var match *Rule
+	for _, r := range f.rules {
+		if !hasPrefix(args, r.args) || len(r.responses) == 0 {
+			continue
+		}
+		if match == nil || len(r.args) >= len(match.args) {
+			match = r
+		}
+	}
+
+	if match == nil {
+		return Response{}, false
+	}
+
+	i := min(match.hits, len(match.responses)-1)
+	match.hits++
+	return match.responses[i], true
+}
+
+func hasPrefix(args, prefix []string) bool {
+	if len(prefix) > len(args) {
+		return false
+	}
+
+	for i, p := range prefix {
+		if !strings.EqualFold(args[i], p) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// OK is a successful response with the given stdout
+func OK(stdout string) Response {
+	return Response{
+		Stdout: stdout,
+	}
+}
+
+// Fail is a failed response, wsl.exe prints the error message and error code to stdout
+func Fail(message, code string) Response {
+	return Response{
+		Stdout:   fmt.Sprintf("%s\r\nError code: %s\r\n", message, code),
+		ExitCode: failureExitCode,
+	}
+}
+
+// Running is a response that keeps running until the context is done
+func Running(stdout string) Response {
+	return Response{
+		Stdout: stdout,
+		Block:  true,
+	}
+}
+
+// VHDAlreadyAttached is the output of `wsl --mount --bare --vhd` when the disk is already attached
+func VHDAlreadyAttached() Response {
+	return Fail(
+		"The disk is already attached.",
+		"Wsl/Service/AttachDisk/WSL_E_USER_VHD_ALREADY_ATTACHED",
+	)
+}
+
+// VHDNotAttached is the output of `wsl --unmount` when the disk is not attached
+func VHDNotAttached() Response {
+	return Fail(
+		"The system cannot find the file specified.",
+		"Wsl/Service/DetachDisk/ERROR_FILE_NOT_FOUND",
+	)
+}
+
+// SharingViolation is the output of `wsl --manage --move` when the disk is still in use
+func SharingViolation() Response {
+	return Fail(
+		"The process cannot access the file because it is being used by another process.",
+		"Wsl/Service/MoveDistro/ERROR_SHARING_VIOLATION",
+	)
+}
+
+// DistroNotStopped is the output of `wsl --manage --move` when the distro is still running
+func DistroNotStopped() Response {
+	return Fail(
+		"The operation could not be completed because the distribution is running.",
+		"Wsl/Service/MoveDistro/WSL_E_DISTRO_NOT_STOPPED",
+	)
+}
+
+// HyperVNotInstalled is the output of any command that starts the utility VM when virtualization is not available
+func HyperVNotInstalled() Response {
+	return Fail(
+		"Please enable the Virtual Machine Platform Windows feature and ensure virtualization is enabled in the BIOS.\r\nFor information please visit https://aka.ms/enablevirtualization",
+		"Wsl/Service/CreateInstance/CreateVm/HCS/HCS_E_HYPERV_NOT_INSTALLED",
+	)
+}